@@ -0,0 +1,166 @@
+package semaphore
+
+import (
+	"context"
+	"os"
+	ossignal "os/signal"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// BreakByTimeout returns a new Interrupter that fires after the timeout.
+// Its reason is the timeout error.
+func BreakByTimeout(timeout time.Duration) Interrupter {
+	return BreakByDeadline(time.Now().Add(timeout))
+}
+
+// BreakByDeadline returns a new Interrupter that fires at the deadline.
+// Its reason is the timeout error.
+func BreakByDeadline(deadline time.Time) Interrupter {
+	breaker := newInterrupter()
+	breaker.deadline = deadline
+	timer := time.AfterFunc(time.Until(deadline), func() { breaker.fire(errTimeout) })
+	breaker.stop = func() { timer.Stop() }
+	return breaker
+}
+
+// BreakByContext returns a new Interrupter that fires when the context is done.
+// Close calls the cancel function. Its reason is the error of the context.
+func BreakByContext(ctx context.Context, cancel context.CancelFunc) Interrupter {
+	return contextInterrupter{ctx, cancel}
+}
+
+// BreakBySignal returns a new Interrupter that fires when the process
+// receives one of the signals. Its reason is a *SignalError.
+func BreakBySignal(signals ...os.Signal) Interrupter {
+	breaker := newInterrupter()
+	if len(signals) == 0 {
+		return breaker
+	}
+	ch := make(chan os.Signal, 1)
+	ossignal.Notify(ch, signals...)
+	go func() {
+		defer ossignal.Stop(ch)
+		select {
+		case sig := <-ch:
+			breaker.fire(&SignalError{Signal: sig})
+		case <-breaker.done:
+		}
+	}()
+	return breaker
+}
+
+// BreakByChannel returns a new Interrupter that fires when the channel
+// is closed or receives a value. Its reason is the interrupt error.
+// It watches the channel by a goroutine that exits when the Interrupter
+// fires, so Close must be called if the channel may stay open.
+func BreakByChannel(ch <-chan struct{}) Interrupter {
+	breaker := newInterrupter()
+	go func() {
+		select {
+		case <-ch:
+			breaker.fire(errInterrupted)
+		case <-breaker.done:
+		}
+	}()
+	return breaker
+}
+
+// Multiplex returns a new Interrupter that fires when any of the breakers fires.
+// Its reason is the reason of that breaker if it reports one.
+// Its deadline is the earliest deadline of the breakers. The nil breakers
+// are skipped. It watches the breakers by a goroutine that exits when
+// the Interrupter fires, so Close must be called if none of them may fire.
+// Close does not close the breakers, they are still owned by the caller.
+func Multiplex(breakers ...Breaker) Interrupter {
+	breaker := newInterrupter()
+	cases := make([]reflect.SelectCase, 0, len(breakers)+1)
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(breaker.done)})
+	for _, child := range breakers {
+		if child == nil {
+			continue
+		}
+		breaker.children = append(breaker.children, child)
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(child.Done())})
+		if deadline, ok := deadlineOf(child); ok && (breaker.deadline.IsZero() || deadline.Before(breaker.deadline)) {
+			breaker.deadline = deadline
+		}
+	}
+	if len(breaker.children) == 0 {
+		return breaker
+	}
+	go func() {
+		chosen, _, _ := reflect.Select(cases)
+		if chosen == 0 {
+			return
+		}
+		err := error(errInterrupted)
+		if reasoner, is := breaker.children[chosen-1].(interface{ Err() error }); is && reasoner.Err() != nil {
+			err = reasoner.Err()
+		}
+		breaker.fire(err)
+	}()
+	return breaker
+}
+
+type interrupter struct {
+	done     chan struct{}
+	once     sync.Once
+	err      error
+	deadline time.Time
+	stop     func()
+	children []Breaker
+}
+
+func newInterrupter() *interrupter {
+	return &interrupter{done: make(chan struct{})}
+}
+
+func (breaker *interrupter) Done() <-chan struct{} {
+	return breaker.done
+}
+
+func (breaker *interrupter) Close() {
+	breaker.fire(errInterrupted)
+	if breaker.stop != nil {
+		breaker.stop()
+	}
+}
+
+func (breaker *interrupter) Err() error {
+	select {
+	case <-breaker.done:
+		return breaker.err
+	default:
+		return nil
+	}
+}
+
+func (breaker *interrupter) Deadline() (time.Time, bool) {
+	return breaker.deadline, !breaker.deadline.IsZero()
+}
+
+// Unwrap returns the breakers multiplexed by the Interrupter.
+func (breaker *interrupter) Unwrap() []Breaker {
+	return breaker.children
+}
+
+// fire closes the Done channel once and remembers the reason.
+func (breaker *interrupter) fire(err error) {
+	breaker.once.Do(func() {
+		breaker.err = err
+		close(breaker.done)
+	})
+}
+
+type contextInterrupter struct {
+	context.Context
+	cancel context.CancelFunc
+}
+
+func (breaker contextInterrupter) Close() {
+	if breaker.cancel != nil {
+		breaker.cancel()
+	}
+}
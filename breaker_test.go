@@ -0,0 +1,119 @@
+package semaphore
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakByTimeout(t *testing.T) {
+	breaker := BreakByTimeout(time.Millisecond)
+	deadline, ok := deadlineOf(breaker)
+	assert.True(t, ok)
+	assert.False(t, deadline.IsZero())
+
+	<-breaker.Done()
+	assert.True(t, IsTimeout(breaker.Err()))
+	breaker.Close()
+	assert.True(t, IsTimeout(breaker.Err()))
+
+	breaker = BreakByTimeout(time.Hour)
+	assert.NoError(t, breaker.Err())
+	breaker.Close()
+	<-breaker.Done()
+	assert.True(t, IsInterrupted(breaker.Err()))
+}
+
+func TestBreakByDeadline(t *testing.T) {
+	breaker := BreakByDeadline(time.Now().Add(-time.Second))
+	<-breaker.Done()
+	assert.True(t, IsTimeout(breaker.Err()))
+
+	semaphore := NewWeighted(1)
+	releaser, err := semaphore.Acquire(nil)
+	assert.NoError(t, err)
+	_, err = semaphore.Acquire(BreakByTimeout(time.Millisecond))
+	assert.True(t, IsTimeout(err))
+	assert.NoError(t, releaser.Release())
+}
+
+func TestBreakByContext(t *testing.T) {
+	breaker := BreakByContext(context.WithTimeout(context.Background(), time.Hour))
+	_, ok := deadlineOf(breaker)
+	assert.True(t, ok)
+	assert.NoError(t, breaker.Err())
+
+	breaker.Close()
+	<-breaker.Done()
+	assert.Equal(t, context.Canceled, breaker.Err())
+
+	breaker = BreakByContext(context.Background(), nil)
+	assert.NotPanics(t, breaker.Close)
+	assert.NoError(t, breaker.Err())
+}
+
+func TestBreakBySignal(t *testing.T) {
+	breaker := BreakBySignal(os.Interrupt)
+	assert.NoError(t, breaker.Err())
+	breaker.Close()
+	<-breaker.Done()
+	assert.True(t, IsInterrupted(breaker.Err()))
+
+	assert.Equal(t, "interrupted by signal interrupt", (&SignalError{Signal: os.Interrupt}).Error())
+	assert.True(t, IsSignal(&SignalError{Signal: os.Interrupt}))
+}
+
+func TestBreakByChannel(t *testing.T) {
+	ch := make(chan struct{})
+	breaker := BreakByChannel(ch)
+	assert.NoError(t, breaker.Err())
+	close(ch)
+	<-breaker.Done()
+	assert.True(t, IsInterrupted(breaker.Err()))
+}
+
+func TestMultiplex(t *testing.T) {
+	early, late := BreakByTimeout(time.Millisecond), BreakByTimeout(time.Hour)
+	breaker := Multiplex(late, early)
+	deadline, ok := deadlineOf(breaker)
+	assert.True(t, ok)
+	expected, _ := deadlineOf(early)
+	assert.Equal(t, expected, deadline)
+
+	<-breaker.Done()
+	assert.True(t, IsTimeout(breaker.Err()))
+	assert.NoError(t, late.Err())
+	breaker.Close()
+	assert.NoError(t, late.Err(), "the breakers must be owned by the caller")
+	late.Close()
+
+	ch := make(chan struct{})
+	breaker = Multiplex(nil, BreakByChannel(ch), nil)
+	_, ok = deadlineOf(breaker)
+	assert.False(t, ok)
+	assert.Len(t, breaker.(interface{ Unwrap() []Breaker }).Unwrap(), 1)
+	close(ch)
+	<-breaker.Done()
+	assert.True(t, IsInterrupted(breaker.Err()))
+
+	breaker = Multiplex(nil)
+	assert.NoError(t, breaker.Err())
+	breaker.Close()
+	assert.True(t, IsInterrupted(breaker.Err()))
+}
+
+func TestMultiplex_Close(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	child := BreakByChannel(make(chan struct{}))
+	breaker := Multiplex(child)
+	breaker.Close()
+	child.Close()
+	for runtime.NumGoroutine() > goroutines {
+		runtime.Gosched()
+	}
+	assert.True(t, IsInterrupted(breaker.Err()))
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package semaphore
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakBySignal_Delivery(t *testing.T) {
+	breaker := BreakBySignal(syscall.SIGUSR1)
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	<-breaker.Done()
+	assert.True(t, IsSignal(breaker.Err()))
+	assert.Equal(t, syscall.SIGUSR1, breaker.Err().(*SignalError).Signal)
+}
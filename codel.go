@@ -0,0 +1,53 @@
+package semaphore
+
+import "time"
+
+// codel implements the Controlled Delay queue management for waiters.
+// If the minimum sojourn time of waiters stays above the target during
+// the whole interval, the queue is considered overloaded and the waiters
+// exceeding the target are shed, starting from the oldest one.
+// The overloaded state is reset when the queue drains.
+type codel struct {
+	target   time.Duration
+	interval time.Duration
+
+	deadline   time.Time
+	min        time.Duration
+	sampled    bool
+	overloaded bool
+}
+
+// observe registers the sojourn time of a served waiter.
+func (policy *codel) observe(now time.Time, sojourn time.Duration) {
+	policy.check(now, sojourn)
+	if !policy.sampled || sojourn < policy.min {
+		policy.min, policy.sampled = sojourn, true
+	}
+}
+
+// check closes the current interval if it is expired. The sojourn time
+// of the oldest waiter is used if nobody was served during the interval.
+func (policy *codel) check(now time.Time, sojourn time.Duration) {
+	if policy.deadline.IsZero() {
+		policy.deadline = now.Add(policy.interval)
+		return
+	}
+	if now.Before(policy.deadline) {
+		return
+	}
+	if policy.sampled {
+		sojourn = policy.min
+	}
+	policy.overloaded = sojourn > policy.target
+	policy.deadline, policy.sampled = now.Add(policy.interval), false
+}
+
+// drop reports whether a waiter with the sojourn time should be shed.
+func (policy *codel) drop(sojourn time.Duration) bool {
+	return policy.overloaded && sojourn > policy.target
+}
+
+// reset returns the policy to the normal state.
+func (policy *codel) reset() {
+	policy.deadline, policy.sampled, policy.overloaded = time.Time{}, false, false
+}
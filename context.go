@@ -0,0 +1,149 @@
+package semaphore
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+)
+
+// NewContext returns a copy of the parent context that carries
+// the Releaser of the places occupied in the semaphore.
+func NewContext(parent context.Context, semaphore Interface, releaser Releaser) context.Context {
+	places := uint32(math.MaxUint32)
+	if holder, is := releaser.(Holder); is {
+		places = holder.Places()
+	}
+	return context.WithValue(parent, acquisitionKey{}, &acquisition{
+		semaphore: semaphore,
+		releaser:  releaser,
+		places:    places,
+		parent:    acquisitionOf(parent),
+	})
+}
+
+// FromContext returns the Releaser of the places occupied
+// in the semaphore that is carried by the context.
+// The places released through it are no longer carried.
+func FromContext(ctx context.Context, semaphore Interface) (Releaser, bool) {
+	if acquired := lookup(ctx, semaphore); acquired != nil {
+		return acquired, true
+	}
+	return nil, false
+}
+
+// Holding returns the semaphores in which the context carries
+// the occupied places, starting with the most recent one.
+func Holding(ctx context.Context) []Interface {
+	var semaphores []Interface
+	for acquired := acquisitionOf(ctx); acquired != nil; acquired = acquired.parent {
+		if !acquired.isReleased() && acquired.outer == nil {
+			semaphores = append(semaphores, acquired.semaphore)
+		}
+	}
+	return semaphores
+}
+
+// AcquireContext occupies the places in the semaphore and returns
+// a copy of the context that carries them. The operation can be canceled
+// using the context. In this case, it returns an appropriate error.
+//
+// It is reentrant: if the context already carries enough places occupied
+// in the semaphore, it returns the same context and the Releaser
+// that does nothing, so only the outermost Releaser frees the places.
+// If it carries fewer places, they are grown by the difference, which
+// the returned Releaser gives back. If the places cannot be grown
+// because the Releaser is not a Holder, it returns an appropriate error.
+func AcquireContext(ctx context.Context, semaphore Interface, places ...uint32) (context.Context, Releaser, error) {
+	size := reduce(places...)
+	held := lookup(ctx, semaphore)
+	if held == nil {
+		releaser, err := semaphore.Acquire(contextBreaker{ctx}, places...)
+		if err != nil {
+			return ctx, nil, err
+		}
+		ctx = NewContext(ctx, semaphore, releaser)
+		return ctx, acquisitionOf(ctx), nil
+	}
+	if size <= held.places {
+		return ctx, nothing, nil
+	}
+
+	holder, is := held.releaser.(Holder)
+	if !is {
+		return ctx, nil, errNoPlace
+	}
+	if err := holder.Grow(contextBreaker{ctx}, size-held.places); err != nil {
+		return ctx, nil, err
+	}
+	acquired := &acquisition{
+		semaphore: semaphore,
+		releaser:  holder,
+		places:    size,
+		outer:     held,
+		parent:    acquisitionOf(ctx),
+	}
+	return context.WithValue(ctx, acquisitionKey{}, acquired), acquired, nil
+}
+
+type acquisitionKey struct{}
+
+// acquisition is the entry of the places carried by the context.
+// The entry that grows the places of the outer one gives back
+// only the difference on release.
+type acquisition struct {
+	semaphore Interface
+	releaser  Releaser
+	places    uint32
+	released  int32
+	outer     *acquisition
+	parent    *acquisition
+}
+
+func (acquired *acquisition) Release() error {
+	if !atomic.CompareAndSwapInt32(&acquired.released, 0, 1) {
+		return errEmpty
+	}
+	var err error
+	if acquired.outer != nil {
+		err = acquired.releaser.(Holder).Shrink(acquired.places - acquired.outer.places)
+	} else {
+		err = acquired.releaser.Release()
+	}
+	if err != nil && !IsEmpty(err) {
+		atomic.StoreInt32(&acquired.released, 0)
+	}
+	return err
+}
+
+// isReleased reports whether the places of the entry are given back,
+// including by the outer entry that it grows.
+func (acquired *acquisition) isReleased() bool {
+	for ; acquired != nil; acquired = acquired.outer {
+		if atomic.LoadInt32(&acquired.released) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func acquisitionOf(ctx context.Context) *acquisition {
+	acquired, _ := ctx.Value(acquisitionKey{}).(*acquisition)
+	return acquired
+}
+
+// lookup returns the most recent entry of the places in the semaphore
+// that are still carried by the context.
+func lookup(ctx context.Context, semaphore Interface) *acquisition {
+	for acquired := acquisitionOf(ctx); acquired != nil; acquired = acquired.parent {
+		if acquired.semaphore == semaphore && !acquired.isReleased() {
+			return acquired
+		}
+	}
+	return nil
+}
+
+type contextBreaker struct {
+	context.Context
+}
+
+func (contextBreaker) Close() {}
@@ -0,0 +1,79 @@
+package semaphore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireContext(t *testing.T) {
+	db, cpu := NewWeighted(2), NewWeighted(1)
+
+	ctx, outer, err := AcquireContext(context.Background(), db)
+	assert.NoError(t, err)
+	nested, inner, err := AcquireContext(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, ctx, nested)
+	assert.Equal(t, uint32(1), db.Peek(), "nested acquisition must not be double-counted")
+
+	releaser, held := FromContext(ctx, db)
+	assert.True(t, held)
+	assert.Equal(t, outer, releaser)
+	_, held = FromContext(ctx, cpu)
+	assert.False(t, held)
+
+	ctx, limiter, err := AcquireContext(ctx, cpu)
+	assert.NoError(t, err)
+	assert.Equal(t, []Interface{cpu, db}, Holding(ctx))
+
+	assert.NoError(t, inner.Release())
+	assert.Equal(t, uint32(1), db.Peek(), "only the outermost release must free the places")
+	assert.NoError(t, outer.Release())
+	assert.Equal(t, uint32(0), db.Peek())
+	assert.NoError(t, limiter.Release())
+	assert.Equal(t, uint32(0), cpu.Peek())
+
+	_, held = FromContext(ctx, db)
+	assert.False(t, held, "the released places must not be carried")
+	assert.Empty(t, Holding(ctx))
+	ctx, again, err := AcquireContext(ctx, cpu)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), cpu.Peek(), "the places must be occupied again after the release")
+	assert.NoError(t, again.Release())
+	assert.Equal(t, uint32(0), cpu.Peek())
+
+	busy, _ := cpu.Acquire(nil)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = AcquireContext(canceled, cpu)
+	assert.True(t, IsTimeout(err))
+	assert.NoError(t, busy.Release())
+	assert.Equal(t, uint32(0), cpu.Peek())
+}
+
+func TestAcquireContext_Grow(t *testing.T) {
+	db := NewWeighted(3)
+
+	ctx, outer, err := AcquireContext(context.Background(), db)
+	assert.NoError(t, err)
+	nested, inner, err := AcquireContext(ctx, db, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), db.Peek(), "nested acquisition must grow the places")
+	_, _, err = AcquireContext(nested, db, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), db.Peek())
+
+	assert.NoError(t, inner.Release())
+	assert.Equal(t, uint32(1), db.Peek(), "nested release must give back only the difference")
+	releaser, held := FromContext(nested, db)
+	assert.True(t, held)
+	assert.Equal(t, outer, releaser)
+	assert.NoError(t, outer.Release())
+	assert.Equal(t, uint32(0), db.Peek())
+
+	ctx = NewContext(context.Background(), db, ReleaseFunc(func() {}))
+	_, _, err = AcquireContext(ctx, db, 2)
+	assert.NoError(t, err, "the places of an unknown Releaser must be trusted")
+	assert.Equal(t, uint32(0), db.Peek())
+}
@@ -16,18 +16,37 @@ func Capacity() int {
 	return def.Capacity()
 }
 
+// Close fails all current and future calls of Acquire of the default semaphore
+// with an appropriate error.
+func Close() error {
+	return def.Close()
+}
+
+// Drain blocks until all occupied slots of the default semaphore are released
+// and returns the number of slots that are still occupied if the operation
+// is canceled using deadline.
+func Drain(deadline <-chan struct{}) (int, error) {
+	return def.Drain(deadline)
+}
+
 // Occupied returns a current number of occupied slots of the default semaphore.
 func Occupied() int {
 	return def.Occupied()
 }
 
+// Waiting returns a current number of goroutines waiting for a slot of the default semaphore.
+func Waiting() int {
+	return def.Waiting()
+}
+
 // Release releases the previously occupied slot of the default semaphore.
 func Release() error {
 	return def.Release()
 }
 
 // Signal returns a channel to send to it release function only if Acquire is successful.
-// In any case, the channel will be closed.
+// In any case, the channel will be closed. The release function not received
+// before the deadline is called automatically.
 func Signal(deadline <-chan struct{}) <-chan ReleaseFunc {
 	return def.Signal(deadline)
 }
@@ -1,10 +1,8 @@
 package semaphore
 
 import (
-	"context"
 	"runtime"
 	"testing"
-	"time"
 )
 
 func TestAcquire(t *testing.T) {
@@ -18,15 +16,14 @@ func TestAcquire(t *testing.T) {
 		r, _ := Acquire(nil)
 		rs = append(rs, r)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
-	defer cancel()
+	deadline := make(chan struct{})
+	close(deadline)
 	expected := "operation timeout"
-	if _, err := Acquire(ctx.Done()); err.Error() != expected {
+	if _, err := Acquire(deadline); err.Error() != expected {
 		t.Errorf("an unexpected error. expected: %s; obtained: %v", expected, err)
 	}
 	do()
-	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
-	if r, err := Acquire(ctx.Done()); err != nil {
+	if r, err := Acquire(nil); err != nil {
 		t.Error("an unexpected error", err)
 	} else {
 		r()
@@ -39,12 +36,24 @@ func TestCapacity(t *testing.T) {
 	}
 }
 
+func TestDrain(t *testing.T) {
+	if active, err := Drain(nil); active != 0 || err != nil {
+		t.Errorf("an unexpected result. expected: 0, nil; obtained: %d, %v", active, err)
+	}
+}
+
 func TestOccupied(t *testing.T) {
 	if obtained, expected := Occupied(), 0; obtained != expected {
 		t.Errorf("unexpected occupied places. expected: %d; obtained: %d", expected, obtained)
 	}
 }
 
+func TestWaiting(t *testing.T) {
+	if obtained, expected := Waiting(), 0; obtained != expected {
+		t.Errorf("unexpected waiting goroutines. expected: %d; obtained: %d", expected, obtained)
+	}
+}
+
 func TestRelease(t *testing.T) {
 	if err, expected := Release(), "semaphore is empty"; err.Error() != expected {
 		t.Errorf("an unexpected error. expected: %s; obtained: %v", expected, err)
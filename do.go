@@ -0,0 +1,192 @@
+package semaphore
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Do occupies the places in the semaphore, calls f and releases the places
+// when f returns or panics. The operation can be canceled using breaker.
+// In this case, it returns an appropriate error and f is not called.
+//
+// A panic in f is re-raised after the places are released
+// unless WithRecovery is passed.
+func Do(semaphore Interface, breaker BreakCloser, places uint32, f func() error, options ...DoOption) error {
+	return Run(semaphore, breaker, places, func(context.Context) error { return f() }, options...)
+}
+
+// Run is like Do, but it passes f a context that is canceled when f returns,
+// when the breaker fires or when the time passed by WithMaxHold elapses.
+// If the breaker implements context.Context, it is the parent of that context.
+func Run(semaphore Interface, breaker BreakCloser, places uint32, f func(context.Context) error, options ...DoOption) error {
+	releaser, err := semaphore.Acquire(breaker, places)
+	if err != nil {
+		return err
+	}
+	parent, cancel := parentOf(breaker)
+	defer cancel()
+	return hold(releaser, parent, f, options)
+}
+
+// DoSlot is like Do for the legacy Semaphore. It occupies one slot.
+// The operation can be canceled using deadline channel.
+func DoSlot(semaphore Semaphore, deadline <-chan struct{}, f func() error, options ...DoOption) error {
+	return RunSlot(semaphore, deadline, func(context.Context) error { return f() }, options...)
+}
+
+// RunSlot is like Run for the legacy Semaphore. It occupies one slot.
+// The operation can be canceled using deadline channel. The context passed
+// to f is canceled when f returns, when the deadline channel is closed
+// or when the time passed by WithMaxHold elapses.
+func RunSlot(semaphore Semaphore, deadline <-chan struct{}, f func(context.Context) error, options ...DoOption) error {
+	release, err := semaphore.Acquire(deadline)
+	if err != nil {
+		return err
+	}
+	parent, cancel := cancelOn(context.Background(), deadline)
+	defer cancel()
+	return hold(release, parent, f, options)
+}
+
+// DoOption configures Do, Run and their legacy counterparts.
+type DoOption func(*doConfig)
+
+// WithMaxHold sets the maximum time of holding the places. When it elapses,
+// the context passed to f is canceled. The places are still released
+// only when f returns, so f should respect the context.
+func WithMaxHold(timeout time.Duration) DoOption {
+	return func(cnf *doConfig) {
+		cnf.timeout = timeout
+	}
+}
+
+// WithRecovery converts a panic in f to a *PanicError
+// instead of re-raising it.
+func WithRecovery() DoOption {
+	return func(cnf *doConfig) {
+		cnf.recovery = true
+	}
+}
+
+// WithHoldTimer sets the timer that measures the time passed by WithMaxHold.
+// It is useful in tests.
+func WithHoldTimer(timer Timer) DoOption {
+	return func(cnf *doConfig) {
+		cnf.timer = timer
+	}
+}
+
+type doConfig struct {
+	timeout  time.Duration
+	timer    Timer
+	recovery bool
+}
+
+// hold calls f and releases the places when f returns or panics.
+func hold(releaser Releaser, parent context.Context, f func(context.Context) error, options []DoOption) (err error) {
+	var cnf doConfig
+	for _, configure := range options {
+		configure(&cnf)
+	}
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if cnf.timeout > 0 && cnf.timer != nil {
+		ctx, cancel = withTimer(parent, cnf.timer, cnf.timeout)
+	} else if cnf.timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, cnf.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	defer cancel()
+	defer func() { _ = releaser.Release() }()
+	if cnf.recovery {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err = &PanicError{Value: recovered, Stack: debug.Stack()}
+			}
+		}()
+	}
+	return f(ctx)
+}
+
+// parentOf returns the context that is canceled when the breaker fires.
+// If the breaker is a context, it is the parent of the returned one.
+func parentOf(breaker Breaker) (context.Context, context.CancelFunc) {
+	if ctx, is := breaker.(context.Context); is {
+		return context.WithCancel(ctx)
+	}
+	return cancelOn(context.Background(), done(breaker))
+}
+
+// cancelOn returns the context that is canceled when the channel is closed.
+func cancelOn(parent context.Context, done <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	if done != nil {
+		go func() {
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, cancel
+}
+
+// timedContext is like the context of context.WithTimeout,
+// but the timeout is measured by the timer.
+type timedContext struct {
+	context.Context
+	deadline time.Time
+	done     chan struct{}
+	once     sync.Once
+	err      error
+}
+
+func withTimer(parent context.Context, timer Timer, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx := &timedContext{Context: parent, deadline: timer.Now().Add(timeout), done: make(chan struct{})}
+	expired := timer.After(timeout)
+	go func() {
+		select {
+		case <-parent.Done():
+			ctx.cancel(parent.Err())
+		case <-expired:
+			ctx.cancel(context.DeadlineExceeded)
+		case <-ctx.done:
+		}
+	}()
+	return ctx, func() { ctx.cancel(context.Canceled) }
+}
+
+func (ctx *timedContext) Deadline() (time.Time, bool) {
+	if deadline, ok := ctx.Context.Deadline(); ok && deadline.Before(ctx.deadline) {
+		return deadline, true
+	}
+	return ctx.deadline, true
+}
+
+func (ctx *timedContext) Done() <-chan struct{} {
+	return ctx.done
+}
+
+func (ctx *timedContext) Err() error {
+	select {
+	case <-ctx.done:
+		return ctx.err
+	default:
+		return nil
+	}
+}
+
+// cancel closes the Done channel once and remembers the reason.
+func (ctx *timedContext) cancel(err error) {
+	ctx.once.Do(func() {
+		ctx.err = err
+		close(ctx.done)
+	})
+}
@@ -0,0 +1,119 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDo(t *testing.T) {
+	semaphore := NewWeighted(3)
+	failure := errors.New("failure")
+
+	err := Do(semaphore, nil, 2, func() error {
+		assert.Equal(t, uint32(2), semaphore.Peek())
+		return failure
+	})
+	assert.Equal(t, failure, err)
+	assert.Equal(t, uint32(0), semaphore.Peek())
+
+	breaker := newCloser()
+	breaker.Close()
+	_, _ = semaphore.Try(nil, 3)
+	called := false
+	err = Do(semaphore, breaker, 1, func() error { called = true; return nil })
+	assert.True(t, IsTimeout(err))
+	assert.False(t, called)
+}
+
+func TestDo_Panic(t *testing.T) {
+	semaphore := NewWeighted(1)
+
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = Do(semaphore, nil, 1, func() error { panic("boom") })
+	})
+	assert.Equal(t, uint32(0), semaphore.Peek())
+
+	err := Do(semaphore, nil, 1, func() error { panic("boom") }, WithRecovery())
+	assert.True(t, IsPanic(err))
+	assert.Equal(t, "boom", err.(*PanicError).Value)
+	assert.NotEmpty(t, err.(*PanicError).Stack)
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestRun(t *testing.T) {
+	semaphore := NewWeighted(1)
+	type key struct{}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+	err := Run(semaphore, BreakByContext(ctx, cancel), 1, func(ctx context.Context) error {
+		assert.Equal(t, "value", ctx.Value(key{}))
+		assert.NoError(t, ctx.Err())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), semaphore.Peek())
+
+	timer := &manualTimer{}
+	go timer.expire(1)
+	err = Run(semaphore, nil, 1, func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithMaxHold(time.Second), WithHoldTimer(timer))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, uint32(0), semaphore.Peek())
+
+	breaker := BreakByChannel(make(chan struct{}))
+	err = Run(semaphore, breaker, 1, func(ctx context.Context) error {
+		breaker.Close()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.Equal(t, context.Canceled, err, "the breaker must cancel the context")
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestDoSlot(t *testing.T) {
+	semaphore := New(1)
+
+	err := DoSlot(semaphore, nil, func() error {
+		assert.Equal(t, 1, semaphore.Occupied())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, semaphore.Occupied())
+
+	assert.Panics(t, func() {
+		_ = DoSlot(semaphore, nil, func() error { panic("boom") })
+	})
+	assert.Equal(t, 0, semaphore.Occupied())
+
+	timer := &manualTimer{}
+	go timer.expire(1)
+	err = RunSlot(semaphore, nil, func(ctx context.Context) error {
+		<-ctx.Done()
+		panic(ctx.Err())
+	}, WithMaxHold(time.Second), WithHoldTimer(timer), WithRecovery())
+	assert.True(t, IsPanic(err))
+	assert.Equal(t, context.DeadlineExceeded, err.(*PanicError).Value)
+	assert.Equal(t, 0, semaphore.Occupied())
+
+	deadline := make(chan struct{})
+	err = RunSlot(semaphore, deadline, func(ctx context.Context) error {
+		close(deadline)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.Equal(t, context.Canceled, err, "the deadline must cancel the context")
+	assert.Equal(t, 0, semaphore.Occupied())
+
+	_, _ = semaphore.Catch()
+	deadline = make(chan struct{})
+	close(deadline)
+	assert.True(t, IsTimeout(DoSlot(semaphore, deadline, func() error { return nil })))
+}
@@ -1,42 +1,578 @@
 package semaphore
 
-import "sync/atomic"
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewWeighted constructs a new thread-safe Interface with the given capacity.
+// By default, waiters are served in the order of their arrival.
+func NewWeighted(capacity uint32, options ...Option) Interface {
+	return newDraft(capacity, configure(options))
+}
+
+func newDraft(capacity uint32, cnf config) *draft {
+	semaphore := &draft{id: atomic.AddUint64(&sequence, 1), capacity: capacity, config: cnf}
+	if cnf.codel.target > 0 {
+		semaphore.codel = &codel{target: cnf.codel.target, interval: cnf.codel.interval}
+	}
+	return semaphore
+}
+
+// sequence defines the order of locking semaphores.
+var sequence uint64
+
+// sealed marks the state of the semaphore that can be changed
+// only under the lock, e.g., when someone waits for places.
+const sealed = 1 << 32
 
 type draft struct {
-	state    uint32
+	// state holds the number of occupied places in the low 32 bits
+	// and the sealed flag. While the flag is clear, places are occupied
+	// and freed by CAS without the lock.
+	state    uint64
 	capacity uint32
+	id       uint64
+
+	mu      sync.Mutex
+	closed  bool
+	holding list.List
+	idle    chan struct{}
+	queue   list.List
+	watch   list.List
+	leases  list.List
+	pending uint64
+	busy    time.Time
+	hold    time.Duration
+	flows   map[string]*flow
+	granted map[string]uint64
+	vtime   float64
+	codel   *codel
+	dropped uint64
+	config
+}
+
+type waiter struct {
+	places   uint32
+	upto     uint32
+	flow     *flow
+	elem     *list.Element
+	since    time.Time
+	ready    chan struct{}
+	signal   *signal
+	releaser *releaser
+	err      error
+	// swap marks the waiter of Holder.Swap that is granted by Swap itself
+	// under the locks of both semaphores, the target only alerts it.
+	swap    bool
+	alerted bool
+}
+
+// wake notifies the waiter that it is served or rejected.
+// wake closes the ready channel and delivers the result to the signal.
+// The lease of the signal passes to the delivered Releaser, and it ends
+// with the rejected signal. It must be called under the lock.
+func (w *waiter) wake(semaphore *draft) {
+	w.alert()
+	if w.signal != nil {
+		if w.releaser != nil {
+			w.releaser.lease = w.signal.lease
+		} else {
+			semaphore.unlease(w.signal.lease)
+		}
+		w.signal.deliver(w.releaser)
+	}
+}
+
+// alert closes the ready channel once. It must be called under the lock.
+func (w *waiter) alert() {
+	if !w.alerted {
+		w.alerted = true
+		close(w.ready)
+	}
 }
 
 func (semaphore *draft) Release() error {
-	panic("implement me")
+	if semaphore.drop(1) {
+		return nil
+	}
+	return semaphore.release(1, time.Time{})
 }
 
 func (semaphore *draft) Acquire(breaker BreakCloser, places ...uint32) (Releaser, error) {
-	_ = reduce(places...)
-	panic("implement me")
+	size := reduce(places...)
+	releaser, err := semaphore.acquire(breaker, size, size)
+	if err != nil {
+		return nil, err
+	}
+	if semaphore.autorelease {
+		semaphore.bind(breaker, releaser)
+	}
+	return releaser, nil
 }
 
-func (semaphore *draft) Try(breaker Breaker, places ...uint32) (Releaser, error) {
-	_ = reduce(places...)
-	panic("implement me")
+func (semaphore *draft) AcquireUpTo(breaker BreakCloser, min, max uint32) (uint32, Releaser, error) {
+	if min == 0 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	releaser, err := semaphore.acquire(breaker, min, max)
+	if err != nil {
+		return 0, nil, err
+	}
+	if semaphore.autorelease {
+		semaphore.bind(breaker, releaser)
+	}
+	return releaser.places, releaser, nil
 }
 
-func (semaphore *draft) Signal(breaker Breaker) <-chan Releaser {
-	panic("implement me")
+func (semaphore *draft) Try(breaker Breaker, places ...uint32) (Releaser, error) {
+	select {
+	case <-done(breaker):
+		return nil, errTimeout
+	default:
+	}
+
+	size, now := reduce(places...), semaphore.now()
+	semaphore.lock()
+	defer semaphore.unlock()
+	if semaphore.closed {
+		return nil, errClosed
+	}
+	if !semaphore.admits(size, now) {
+		return nil, errNoPlace
+	}
+	return semaphore.seize(keyOf(breaker), size, now), nil
 }
 
 func (semaphore *draft) Peek() uint32 {
-	return atomic.LoadUint32(&semaphore.state)
+	return semaphore.occupied()
 }
 
 func (semaphore *draft) Size(new uint32) uint32 {
+	semaphore.lock()
+	defer semaphore.unlock()
 	current := atomic.LoadUint32(&semaphore.capacity)
 	if new != 0 {
 		atomic.StoreUint32(&semaphore.capacity, new)
+		semaphore.notify()
 	}
 	return current
 }
 
+func (semaphore *draft) Stats() Stats {
+	semaphore.lock()
+	defer semaphore.unlock()
+	flows := make(map[string]FlowStats, len(semaphore.granted))
+	for key, granted := range semaphore.granted {
+		flows[key] = FlowStats{Granted: granted}
+	}
+	for key, f := range semaphore.flows {
+		if waiting := uint32(f.queue.Len()); waiting > 0 {
+			flows[key] = FlowStats{Waiting: waiting, Granted: semaphore.granted[key]}
+		}
+	}
+	holders := make([]HolderStats, 0, semaphore.holding.Len())
+	for elem := semaphore.holding.Front(); elem != nil; elem = elem.Next() {
+		releaser := elem.Value.(*releaser)
+		holders = append(holders, HolderStats{
+			Owner:  releaser.owner,
+			Places: releaser.places,
+			Since:  releaser.since,
+		})
+	}
+	return Stats{
+		Capacity: semaphore.capacity,
+		Occupied: semaphore.occupied(),
+		Waiting:  uint32(semaphore.queue.Len()),
+		Dropped:  semaphore.dropped,
+		Flows:    flows,
+		Holders:  holders,
+	}
+}
+
+func (semaphore *draft) Close() error {
+	semaphore.lock()
+	defer semaphore.unlock()
+	if semaphore.closed {
+		return errClosed
+	}
+	semaphore.closed = true
+	for elem := semaphore.queue.Front(); elem != nil; elem = semaphore.queue.Front() {
+		w := elem.Value.(*waiter)
+		semaphore.dequeue(elem)
+		w.err = errClosed
+		w.wake(semaphore)
+	}
+	for elem := semaphore.watch.Front(); elem != nil; elem = semaphore.watch.Front() {
+		o := elem.Value.(*observer)
+		o.err = errClosed
+		o.forget(semaphore)
+		close(o.ready)
+	}
+	return nil
+}
+
+func (semaphore *draft) Drain(breaker Breaker) (uint32, error) {
+	semaphore.lock()
+	if semaphore.occupied() == 0 {
+		semaphore.unlock()
+		return 0, nil
+	}
+	if semaphore.idle == nil {
+		semaphore.idle = make(chan struct{})
+	}
+	idle := semaphore.idle
+	semaphore.unlock()
+
+	select {
+	case <-idle:
+		return 0, nil
+	case <-done(breaker):
+		semaphore.lock()
+		defer semaphore.unlock()
+		if semaphore.occupied() == 0 {
+			return 0, nil
+		}
+		return uint32(semaphore.holding.Len()), errTimeout
+	}
+}
+
+// acquire occupies at least size and at most upto places.
+func (semaphore *draft) acquire(breaker Breaker, size, upto uint32) (*releaser, error) {
+	now := semaphore.now()
+	semaphore.lock()
+	if !semaphore.closed && semaphore.admits(size, now) {
+		// the places are free, so the waiter is not needed
+		releaser := semaphore.seize(keyOf(breaker), semaphore.greed(size, upto), now)
+		semaphore.unlock()
+		return releaser, nil
+	}
+	w := &waiter{places: size, upto: upto, since: now, ready: make(chan struct{})}
+	elem, err := semaphore.enter(breaker, w)
+	semaphore.unlock()
+	if err != nil {
+		return nil, err
+	}
+	if elem == nil {
+		return w.releaser, nil
+	}
+
+	select {
+	case <-w.ready:
+		if w.err != nil {
+			return nil, w.err
+		}
+		return w.releaser, nil
+	case <-done(breaker):
+		semaphore.lock()
+		defer semaphore.unlock()
+		select {
+		case <-w.ready:
+			// the waiter was served concurrently with the cancellation
+			if w.err != nil {
+				return nil, w.err
+			}
+			semaphore.forget(w.releaser)
+			semaphore.free(w.releaser.places)
+		default:
+			semaphore.dequeue(elem)
+		}
+		semaphore.notify()
+		return nil, errTimeout
+	}
+}
+
+// enter occupies the places for the waiter or puts it in the queue.
+// It returns nil element if the waiter is served immediately.
+// It must be called under the lock.
+func (semaphore *draft) enter(breaker Breaker, w *waiter) (*list.Element, error) {
+	if semaphore.closed {
+		return nil, errClosed
+	}
+	if semaphore.admits(w.places, w.since) {
+		w.releaser = semaphore.seize(keyOf(breaker), semaphore.greed(w.places, w.upto), w.since)
+		return nil, nil
+	}
+	if semaphore.waiters > 0 && semaphore.queue.Len() >= semaphore.waiters {
+		return nil, errQueueFull
+	}
+	if err := semaphore.estimate(breaker, w.places, w.since); err != nil {
+		return nil, err
+	}
+	w.flow = semaphore.flow(keyOf(breaker))
+	elem := semaphore.enqueue(w)
+	semaphore.notify()
+	return elem, nil
+}
+
+func (semaphore *draft) release(size uint32, since time.Time) error {
+	now := semaphore.now()
+	semaphore.lock()
+	defer semaphore.unlock()
+	return semaphore.vacate(size, since, now)
+}
+
+// vacate frees the places and serves the waiters.
+// The zero since means the places are not held by a Releaser.
+// It must be called under the lock.
+func (semaphore *draft) vacate(size uint32, since, now time.Time) error {
+	if semaphore.occupied() == 0 {
+		return errEmpty
+	}
+	if !since.IsZero() {
+		if hold := now.Sub(since); semaphore.hold == 0 {
+			semaphore.hold = hold
+		} else {
+			semaphore.hold += (hold - semaphore.hold) / 8
+		}
+	}
+	semaphore.free(size)
+	semaphore.notify()
+	return nil
+}
+
+// notify sheds the waiters rejected by the admission policy
+// and serves the rest while they fit the capacity.
+// It must be called under the lock.
+func (semaphore *draft) notify() {
+	now := semaphore.now()
+	if semaphore.codel != nil {
+		semaphore.shed(now)
+	}
+	for elem := semaphore.next(now); elem != nil; elem = semaphore.next(now) {
+		w := elem.Value.(*waiter)
+		if !semaphore.fits(w.places) {
+			break
+		}
+		if w.swap {
+			// the exchange holds the turn until Swap makes it
+			w.alert()
+			break
+		}
+		semaphore.dequeue(elem)
+		w.releaser = semaphore.occupy(w.flow.key, w.flow, semaphore.greed(w.places, w.upto), now)
+		if semaphore.codel != nil {
+			semaphore.codel.observe(now, now.Sub(w.since))
+		}
+		w.wake(semaphore)
+	}
+	if semaphore.codel != nil && semaphore.queue.Len() == 0 {
+		semaphore.codel.reset()
+	}
+	semaphore.observe()
+}
+
+// shed drops the oldest waiters while the CoDel policy considers
+// the queue overloaded. It must be called under the lock.
+func (semaphore *draft) shed(now time.Time) {
+	if elem := semaphore.queue.Front(); elem != nil {
+		semaphore.codel.check(now, now.Sub(elem.Value.(*waiter).since))
+	}
+	for elem := semaphore.queue.Front(); elem != nil; elem = semaphore.queue.Front() {
+		w := elem.Value.(*waiter)
+		if !semaphore.codel.drop(now.Sub(w.since)) {
+			break
+		}
+		semaphore.dequeue(elem)
+		semaphore.dropped++
+		w.err = errOverload
+		w.wake(semaphore)
+	}
+}
+
+// admits reports whether the new waiter can be served immediately.
+// It must be called under the lock.
+func (semaphore *draft) admits(size uint32, now time.Time) bool {
+	return (semaphore.queue.Len() == 0 || semaphore.lifo(now)) && semaphore.fits(size)
+}
+
+// next returns the waiter that must be served first.
+// It must be called under the lock.
+func (semaphore *draft) next(now time.Time) *list.Element {
+	f := semaphore.pick()
+	if f == nil {
+		return nil
+	}
+	if semaphore.lifo(now) {
+		return f.queue.Back().Value.(*list.Element)
+	}
+	return f.queue.Front().Value.(*list.Element)
+}
+
+// lifo reports whether waiters are served in LIFO order at the moment.
+// It must be called under the lock.
+func (semaphore *draft) lifo(now time.Time) bool {
+	switch semaphore.order {
+	case LIFO:
+		return true
+	case AdaptiveLIFO:
+		return semaphore.queue.Len() > 0 && now.Sub(semaphore.busy) >= semaphore.threshold
+	}
+	return false
+}
+
+// estimate rejects the waiter if the breaker has a deadline
+// that comes before the estimated waiting time elapses.
+// The estimation is based on the places requested by the waiters
+// ahead and the average time the places are held.
+// It must be called under the lock.
+func (semaphore *draft) estimate(breaker Breaker, size uint32, now time.Time) error {
+	if semaphore.hold == 0 || semaphore.capacity == 0 {
+		return nil
+	}
+	deadline, ok := deadlineOf(breaker)
+	if !ok {
+		return nil
+	}
+
+	need := uint64(size) + uint64(semaphore.occupied())
+	if !semaphore.lifo(now) {
+		need += semaphore.pending
+	}
+	if need <= uint64(semaphore.capacity) {
+		return nil
+	}
+	rounds := (need - 1) / uint64(semaphore.capacity)
+	estimated, available := time.Duration(rounds)*semaphore.hold, deadline.Sub(now)
+	if estimated <= available {
+		return nil
+	}
+	return &DeadlineError{Estimated: estimated, Available: available}
+}
+
+func (semaphore *draft) enqueue(w *waiter) *list.Element {
+	if semaphore.queue.Len() == 0 {
+		semaphore.busy = w.since
+	}
+	semaphore.activate(w.flow)
+	elem := semaphore.queue.PushBack(w)
+	w.elem = w.flow.queue.PushBack(elem)
+	semaphore.pending += uint64(w.places)
+	return elem
+}
+
+func (semaphore *draft) dequeue(elem *list.Element) {
+	w := semaphore.queue.Remove(elem).(*waiter)
+	w.flow.queue.Remove(w.elem)
+	semaphore.pending -= uint64(w.places)
+	semaphore.settle(w.flow)
+}
+
+// greed returns the number of places up to the limit that can be occupied
+// in addition to the required ones. It must be called under the lock.
+func (semaphore *draft) greed(size, upto uint32) uint32 {
+	if free := semaphore.capacity - semaphore.occupied(); upto > size && free > size {
+		if free < upto {
+			return free
+		}
+		return upto
+	}
+	return size
+}
+
+func (semaphore *draft) fits(size uint32) bool {
+	return uint64(semaphore.occupied())+uint64(size) <= uint64(semaphore.capacity)
+}
+
+func (semaphore *draft) occupy(key string, f *flow, size uint32, now time.Time) *releaser {
+	atomic.AddUint64(&semaphore.state, uint64(size))
+	semaphore.grant(key, f, size)
+	releaser := &releaser{semaphore: semaphore, places: size, since: now}
+	releaser.elem = semaphore.holding.PushBack(releaser)
+	return releaser
+}
+
+// forget removes the Releaser from the active holders.
+// It must be called under the lock.
+func (semaphore *draft) forget(releaser *releaser) {
+	releaser.released = true
+	semaphore.holding.Remove(releaser.elem)
+	semaphore.unlease(releaser.lease)
+}
+
+func (semaphore *draft) free(size uint32) {
+	if occupied := semaphore.occupied(); size > occupied {
+		size = occupied
+	}
+	atomic.AddUint64(&semaphore.state, -uint64(size))
+	if semaphore.occupied() == 0 && semaphore.idle != nil {
+		close(semaphore.idle)
+		semaphore.idle = nil
+	}
+}
+
+// lock locks the semaphore and seals its state.
+func (semaphore *draft) lock() {
+	semaphore.mu.Lock()
+	if state := atomic.LoadUint64(&semaphore.state); state&sealed == 0 {
+		for !atomic.CompareAndSwapUint64(&semaphore.state, state, state|sealed) {
+			state = atomic.LoadUint64(&semaphore.state)
+		}
+	}
+}
+
+// unlock unseals the state of the semaphore if nobody waits for places
+// or watches for them and unlocks the semaphore.
+func (semaphore *draft) unlock() {
+	if semaphore.queue.Len() == 0 && semaphore.watch.Len() == 0 &&
+		semaphore.idle == nil && !semaphore.closed {
+		atomic.AddUint64(&semaphore.state, ^uint64(sealed-1))
+	}
+	semaphore.mu.Unlock()
+}
+
+// grab occupies the places without the lock if the state is not sealed.
+// It reports whether the places are occupied.
+func (semaphore *draft) grab(size uint32) bool {
+	for {
+		state := atomic.LoadUint64(&semaphore.state)
+		if state&sealed != 0 || uint64(uint32(state))+uint64(size) > uint64(atomic.LoadUint32(&semaphore.capacity)) {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&semaphore.state, state, state+uint64(size)) {
+			return true
+		}
+	}
+}
+
+// drop frees the places without the lock if the state is not sealed.
+// It reports whether the places are freed.
+func (semaphore *draft) drop(size uint32) bool {
+	for {
+		state := atomic.LoadUint64(&semaphore.state)
+		if state&sealed != 0 || uint32(state) < size {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&semaphore.state, state, state-uint64(size)) {
+			return true
+		}
+	}
+}
+
+// occupied returns the number of occupied places.
+func (semaphore *draft) occupied() uint32 {
+	return uint32(atomic.LoadUint64(&semaphore.state))
+}
+
+func done(breaker Breaker) <-chan struct{} {
+	if breaker == nil {
+		return nil
+	}
+	return breaker.Done()
+}
+
+func deadlineOf(breaker Breaker) (time.Time, bool) {
+	if deadliner, is := breaker.(interface{ Deadline() (time.Time, bool) }); is {
+		return deadliner.Deadline()
+	}
+	return time.Time{}, false
+}
+
 func reduce(places ...uint32) uint32 {
 	var capacity uint32
 	for _, size := range places {
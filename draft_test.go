@@ -1 +1,290 @@
 package semaphore
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDraft_Acquire_Weighted(t *testing.T) {
+	semaphore := NewWeighted(5)
+
+	releaser, err := semaphore.Acquire(nil, 2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), semaphore.Peek())
+
+	_, err = semaphore.Try(nil, 3)
+	assert.True(t, IsNoPlace(err))
+
+	assert.NoError(t, releaser.Release())
+	assert.True(t, IsEmpty(releaser.Release()))
+	assert.Equal(t, uint32(0), semaphore.Peek())
+	assert.True(t, IsEmpty(semaphore.Release()))
+}
+
+func TestDraft_AcquireUpTo(t *testing.T) {
+	semaphore := NewWeighted(10)
+	releaser, _ := semaphore.Acquire(nil, 7)
+
+	places, greedy, err := semaphore.AcquireUpTo(nil, 1, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), places)
+	assert.Equal(t, uint32(10), semaphore.Peek())
+
+	done := make(chan uint32)
+	go func() {
+		places, releaser, _ := semaphore.AcquireUpTo(nil, 2, 4)
+		done <- places
+		_ = releaser.Release()
+	}()
+	waitFor(semaphore, 1)
+	assert.NoError(t, greedy.Release())
+	assert.Equal(t, uint32(3), <-done)
+
+	assert.NoError(t, releaser.Release())
+	places, greedy, _ = semaphore.AcquireUpTo(nil, 1, 4)
+	assert.Equal(t, uint32(4), places)
+	assert.NoError(t, greedy.Release())
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestDraft_Acquire_Cancel(t *testing.T) {
+	semaphore := NewWeighted(1)
+	releaser, _ := semaphore.Acquire(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := semaphore.Acquire(&breaker{ctx}, 1)
+		done <- err
+	}()
+	waitFor(semaphore, 1)
+	cancel()
+
+	assert.True(t, IsTimeout(<-done))
+	assert.Equal(t, uint32(0), semaphore.Stats().Waiting)
+	assert.NoError(t, releaser.Release())
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestDraft_Size(t *testing.T) {
+	semaphore := NewWeighted(1)
+	releaser, _ := semaphore.Acquire(nil)
+
+	done := make(chan Releaser)
+	go func() {
+		releaser, _ := semaphore.Acquire(nil, 2)
+		done <- releaser
+	}()
+	waitFor(semaphore, 1)
+
+	assert.Equal(t, uint32(1), semaphore.Size(3))
+	assert.NoError(t, (<-done).Release())
+	assert.NoError(t, releaser.Release())
+	assert.Equal(t, uint32(3), semaphore.Size(0))
+}
+
+func TestDraft_Close(t *testing.T) {
+	semaphore := NewWeighted(3)
+	first, _ := semaphore.Acquire(nil, 2)
+	second, _ := semaphore.Acquire(nil)
+
+	done := make(chan error)
+	go func() {
+		_, err := semaphore.Acquire(nil, 2)
+		done <- err
+	}()
+	waitFor(semaphore, 1)
+
+	assert.NoError(t, semaphore.Close())
+	assert.True(t, IsClosed(semaphore.Close()))
+	assert.True(t, IsClosed(<-done))
+	_, err := semaphore.Try(nil)
+	assert.True(t, IsClosed(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	active, err := semaphore.Drain(ctx)
+	assert.True(t, IsTimeout(err))
+	assert.Equal(t, uint32(2), active)
+
+	assert.NoError(t, first.Release())
+	go func() { _ = second.Release() }()
+	active, err = semaphore.Drain(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), active)
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestDraft_CoDel(t *testing.T) {
+	var clock int64
+	semaphore := NewWeighted(1, WithCoDel(10*time.Millisecond, 100*time.Millisecond), withClock(&clock))
+	releaser, _ := semaphore.Acquire(nil)
+
+	done := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			releaser, err := semaphore.Acquire(nil)
+			if err == nil {
+				_ = releaser.Release()
+			}
+			done <- err
+		}()
+	}
+	waitFor(semaphore, 3)
+
+	atomic.AddInt64(&clock, int64(150*time.Millisecond))
+	assert.NoError(t, releaser.Release())
+	for i := 0; i < 3; i++ {
+		assert.True(t, IsOverloaded(<-done))
+	}
+	assert.Equal(t, uint64(3), semaphore.Stats().Dropped)
+
+	releaser, err := semaphore.Acquire(nil)
+	assert.NoError(t, err)
+	go func() { done <- releaser.Release() }()
+	_, err = semaphore.Acquire(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, <-done)
+}
+
+func TestDraft_CoDel_BelowTarget(t *testing.T) {
+	var clock int64
+	semaphore := NewWeighted(1, WithCoDel(10*time.Millisecond, 100*time.Millisecond), withClock(&clock))
+	releaser, _ := semaphore.Acquire(nil)
+
+	done := make(chan Releaser, 1)
+	acquire := func() {
+		releaser, _ := semaphore.Acquire(nil)
+		done <- releaser
+	}
+	go acquire()
+	waitFor(semaphore, 1)
+	for i := 0; i < 60; i++ {
+		go acquire()
+		waitFor(semaphore, 2)
+		atomic.AddInt64(&clock, int64(5*time.Millisecond))
+		assert.NoError(t, releaser.Release())
+		releaser = <-done
+		if !assert.NotNil(t, releaser) {
+			return
+		}
+	}
+	assert.NoError(t, releaser.Release())
+	assert.NoError(t, (<-done).Release())
+	assert.Equal(t, uint64(0), semaphore.Stats().Dropped)
+}
+
+func TestDraft_Acquire_Deadline(t *testing.T) {
+	var clock int64
+	semaphore := NewWeighted(1, withClock(&clock))
+	releaser, _ := semaphore.Acquire(nil)
+	atomic.AddInt64(&clock, int64(100*time.Millisecond))
+	assert.NoError(t, releaser.Release())
+	releaser, _ = semaphore.Acquire(nil)
+
+	now := time.Unix(0, atomic.LoadInt64(&clock))
+	_, err := semaphore.Acquire(deadline(now.Add(50 * time.Millisecond)))
+	assert.True(t, IsDeadline(err))
+	assert.Equal(t, &DeadlineError{Estimated: 100 * time.Millisecond, Available: 50 * time.Millisecond}, err)
+
+	done := make(chan Releaser)
+	go func() {
+		releaser, _ := semaphore.Acquire(deadline(now.Add(150 * time.Millisecond)))
+		done <- releaser
+	}()
+	waitFor(semaphore, 1)
+	assert.NoError(t, releaser.Release())
+	assert.NoError(t, (<-done).Release())
+}
+
+func TestDraft_Order(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		option   Option
+		expected []int
+	}{
+		{name: "FIFO", option: WithOrder(FIFO), expected: []int{1, 2, 3}},
+		{name: "LIFO", option: WithOrder(LIFO), expected: []int{3, 2, 1}},
+		{name: "adaptive LIFO", option: WithAdaptiveLIFO(50 * time.Millisecond), expected: []int{1, 3, 2}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var clock int64
+			semaphore := NewWeighted(1, tc.option, withClock(&clock))
+			releaser, _ := semaphore.Acquire(nil)
+
+			type admission struct {
+				id       int
+				releaser Releaser
+			}
+			admitted := make(chan admission)
+			for id := 1; id <= 3; id++ {
+				go func(id int) {
+					releaser, _ := semaphore.Acquire(nil)
+					admitted <- admission{id, releaser}
+				}(id)
+				waitFor(semaphore, uint32(id))
+			}
+
+			obtained := make([]int, 0, 3)
+			for range tc.expected {
+				atomic.AddInt64(&clock, int64(30*time.Millisecond))
+				assert.NoError(t, releaser.Release())
+				next := <-admitted
+				obtained, releaser = append(obtained, next.id), next.releaser
+			}
+			assert.NoError(t, releaser.Release())
+			assert.Equal(t, tc.expected, obtained)
+		})
+	}
+}
+
+type breaker struct{ context.Context }
+
+func (breaker) Close() {}
+
+type deadline time.Time
+
+func (deadline) Done() <-chan struct{} { return nil }
+
+func (deadline) Close() {}
+
+func (deadline deadline) Deadline() (time.Time, bool) { return time.Time(deadline), true }
+
+func waitFor(semaphore interface{ Stats() Stats }, waiters uint32) {
+	for semaphore.Stats().Waiting != waiters {
+		runtime.Gosched()
+	}
+}
+
+type clock struct{ nanoseconds *int64 }
+
+func (clock clock) Now() time.Time { return time.Unix(0, atomic.LoadInt64(clock.nanoseconds)) }
+
+func withClock(nanoseconds *int64) Option {
+	return WithClock(clock{nanoseconds})
+}
+
+func BenchmarkDraft_Acquire(b *testing.B) {
+	for _, breaker := range []struct {
+		name string
+		new  func() BreakCloser
+	}{
+		{"nil", func() BreakCloser { return nil }},
+		{"flow", func() BreakCloser { return Flow(nil, "tenant") }},
+	} {
+		b.Run(breaker.name, func(b *testing.B) {
+			semaphore, breaker := NewWeighted(1), breaker.new()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				releaser, _ := semaphore.Acquire(breaker)
+				_ = releaser.Release()
+			}
+		})
+	}
+}
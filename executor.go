@@ -0,0 +1,443 @@
+package semaphore
+
+import (
+	"container/list"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// NewExecutor constructs a new executor that runs tasks by workers
+// which number is limited by a semaphore. By default, it has no workers
+// until the first task, at most GOMAXPROCS workers and the queue of the same size,
+// blocks the callers when the queue is full and stops the extra idle workers
+// after a minute.
+func NewExecutor(options ...ExecutorOption) Executor {
+	cnf := executorConfig{max: uint32(runtime.GOMAXPROCS(0)), size: -1, keepalive: time.Minute, policy: Block}
+	for _, configure := range options {
+		configure(&cnf)
+	}
+	if cnf.max == 0 {
+		cnf.max = 1
+	}
+	if cnf.min > cnf.max {
+		cnf.min = cnf.max
+	}
+	if cnf.size < 0 {
+		cnf.size = int(cnf.max)
+	}
+	executor := &executor{workers: NewWeighted(cnf.max), space: make(chan struct{}), executorConfig: cnf}
+	executor.mu.Lock()
+	for i := uint32(0); i < cnf.min; i++ {
+		executor.spawn()
+	}
+	executor.mu.Unlock()
+	return executor
+}
+
+// Executor defines the functionality of a worker pool
+// with the bounded queue of tasks.
+type Executor interface {
+	// Execute puts the task in the queue. If the queue is full, the task
+	// is handled according to the rejection policy. The blocking
+	// can be canceled using breaker. In this case, it returns an appropriate error.
+	Execute(Breaker, Task) error
+	// Shutdown stops accepting new tasks and blocks until the queued
+	// and running tasks are completed. The operation can be canceled
+	// using breaker. In this case, it returns an appropriate error.
+	Shutdown(Breaker) error
+	// ShutdownNow stops accepting new tasks, rejects the queued ones
+	// and returns their number. The running tasks are not interrupted.
+	ShutdownNow() int
+
+	Stats() ExecutorStats
+}
+
+// A Task is a unit of work executed by an Executor.
+type Task interface {
+	// Run executes the task.
+	Run()
+	// Reject is called instead of Run if the task is dropped from the queue
+	// and after Run with a *PanicError if Run panics in a worker.
+	Reject(error)
+}
+
+// TaskFunc is an adapter to use an ordinary function as a Task.
+// The rejected TaskFunc is just not called, and its panic is dropped.
+type TaskFunc func()
+
+// Run calls f().
+func (f TaskFunc) Run() {
+	f()
+}
+
+// Reject does nothing.
+func (f TaskFunc) Reject(error) {}
+
+// A Future represents the result of a task submitted to an Executor.
+type Future[T any] interface {
+	// Done returns a channel that's closed when the task is completed or rejected.
+	Done() <-chan struct{}
+	// Wait blocks until the task is completed or rejected and returns its error.
+	// The operation can be canceled using breaker. In this case,
+	// it returns an appropriate error.
+	Wait(Breaker) error
+	// Result blocks until the task is completed or rejected
+	// and returns its result. If the task panics, the error is a *PanicError.
+	Result() (T, error)
+}
+
+// Submit puts the task in the queue of the executor
+// and returns the Future of its result.
+func Submit[T any](executor Executor, breaker Breaker, task func() (T, error)) (Future[T], error) {
+	f := &future[T]{task: task, done: make(chan struct{})}
+	if err := executor.Execute(breaker, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// ExecutorStats represents a snapshot of an executor state.
+type ExecutorStats struct {
+	// Workers is a current number of workers.
+	Workers uint32
+	// Active is a current number of workers running tasks.
+	Active uint32
+	// Queued is a current number of tasks in the queue.
+	Queued uint32
+	// Completed is a total number of completed tasks.
+	Completed uint64
+	// Rejected is a total number of rejected tasks.
+	Rejected uint64
+}
+
+// RejectionPolicy defines how an Executor handles a task if its queue is full.
+type RejectionPolicy int
+
+const (
+	// Block waits until the queue has a place for the task.
+	Block RejectionPolicy = iota
+	// DropNewest rejects the task.
+	DropNewest
+	// DropOldest rejects the oldest task in the queue to put the new one.
+	DropOldest
+	// CallerRuns runs the task in the goroutine of the caller.
+	CallerRuns
+)
+
+// ExecutorOption configures an Executor.
+type ExecutorOption func(*executorConfig)
+
+// WithWorkers sets the minimum and the maximum number of workers.
+// The minimum number of workers is started at once and never stopped.
+func WithWorkers(min, max uint32) ExecutorOption {
+	return func(cnf *executorConfig) {
+		cnf.min, cnf.max = min, max
+	}
+}
+
+// WithQueueSize sets the maximum number of tasks waiting for a worker.
+// If size is negative, it is equal to the maximum number of workers.
+func WithQueueSize(size int) ExecutorOption {
+	return func(cnf *executorConfig) {
+		cnf.size = size
+	}
+}
+
+// WithRejectionPolicy sets how a task is handled if the queue is full.
+func WithRejectionPolicy(policy RejectionPolicy) ExecutorOption {
+	return func(cnf *executorConfig) {
+		cnf.policy = policy
+	}
+}
+
+// WithKeepAlive sets the time after which an idle worker above
+// the minimum number of workers is stopped.
+func WithKeepAlive(timeout time.Duration) ExecutorOption {
+	return func(cnf *executorConfig) {
+		cnf.keepalive = timeout
+	}
+}
+
+// WithExecutorTimer sets the timer that measures the keep-alive timeout.
+// It is useful in tests.
+func WithExecutorTimer(timer Timer) ExecutorOption {
+	return func(cnf *executorConfig) {
+		cnf.timer = timer
+	}
+}
+
+type executorConfig struct {
+	min, max  uint32
+	size      int
+	policy    RejectionPolicy
+	keepalive time.Duration
+	timer     Timer
+}
+
+type executor struct {
+	workers Interface
+
+	mu         sync.Mutex
+	shutdown   bool
+	queue      list.List
+	idle       list.List
+	space      chan struct{}
+	terminated chan struct{}
+	running    uint32
+	active     uint32
+	completed  uint64
+	rejected   uint64
+	executorConfig
+}
+
+func (executor *executor) Execute(breaker Breaker, task Task) error {
+	executor.mu.Lock()
+	for {
+		if executor.shutdown {
+			executor.mu.Unlock()
+			return errShutdown
+		}
+		// the workers that run no task take the queued ones without delay
+		free := int(executor.running - executor.active)
+		if executor.queue.Len() < executor.size+free || executor.running < executor.max {
+			break
+		}
+		switch executor.policy {
+		case DropNewest:
+			executor.rejected++
+			executor.mu.Unlock()
+			return errRejected
+		case DropOldest:
+			if oldest := executor.queue.Front(); oldest != nil {
+				executor.rejected++
+				executor.queue.Remove(oldest)
+				executor.mu.Unlock()
+				oldest.Value.(Task).Reject(errRejected)
+				executor.mu.Lock()
+				continue
+			}
+			executor.rejected++
+			executor.mu.Unlock()
+			return errRejected
+		case CallerRuns:
+			executor.mu.Unlock()
+			run(task)
+			executor.mu.Lock()
+			executor.completed++
+			executor.mu.Unlock()
+			return nil
+		}
+		space := executor.space
+		executor.mu.Unlock()
+		select {
+		case <-space:
+		case <-done(breaker):
+			return errTimeout
+		}
+		executor.mu.Lock()
+	}
+
+	executor.queue.PushBack(task)
+	if elem := executor.idle.Front(); elem != nil {
+		executor.idle.Remove(elem)
+		elem.Value.(chan struct{}) <- struct{}{}
+	} else if executor.queue.Len() > int(executor.running-executor.active) {
+		executor.spawn()
+	}
+	executor.mu.Unlock()
+	return nil
+}
+
+func (executor *executor) Shutdown(breaker Breaker) error {
+	executor.mu.Lock()
+	terminated := executor.stop()
+	executor.mu.Unlock()
+
+	select {
+	case <-terminated:
+		return nil
+	case <-done(breaker):
+		return errTimeout
+	}
+}
+
+func (executor *executor) ShutdownNow() int {
+	executor.mu.Lock()
+	executor.stop()
+	rejected := make([]Task, 0, executor.queue.Len())
+	for elem := executor.queue.Front(); elem != nil; elem = executor.queue.Front() {
+		rejected = append(rejected, executor.queue.Remove(elem).(Task))
+	}
+	executor.rejected += uint64(len(rejected))
+	executor.mu.Unlock()
+
+	for _, task := range rejected {
+		task.Reject(errShutdown)
+	}
+	return len(rejected)
+}
+
+func (executor *executor) Stats() ExecutorStats {
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+	return ExecutorStats{
+		Workers:   executor.running,
+		Active:    executor.active,
+		Queued:    uint32(executor.queue.Len()),
+		Completed: executor.completed,
+		Rejected:  executor.rejected,
+	}
+}
+
+// stop stops accepting new tasks, wakes the idle workers to exit
+// and returns a channel that's closed when all workers are stopped.
+// It must be called under the lock.
+func (executor *executor) stop() <-chan struct{} {
+	if !executor.shutdown {
+		executor.shutdown = true
+		executor.terminated = make(chan struct{})
+		if executor.running == 0 {
+			close(executor.terminated)
+		}
+		for elem := executor.idle.Front(); elem != nil; elem = executor.idle.Front() {
+			executor.idle.Remove(elem)
+			elem.Value.(chan struct{}) <- struct{}{}
+		}
+		executor.vacate()
+	}
+	return executor.terminated
+}
+
+// spawn starts a new worker if the limit of workers allows it.
+// It must be called under the lock.
+func (executor *executor) spawn() {
+	releaser, err := executor.workers.Try(nil, 1)
+	if err != nil {
+		return
+	}
+	executor.running++
+	go executor.work(releaser, executor.running <= executor.min)
+}
+
+// work runs the queued tasks until the executor is shut down
+// or the worker is idle longer than the keep-alive timeout.
+func (executor *executor) work(releaser Releaser, core bool) {
+	wake := make(chan struct{}, 1)
+	executor.mu.Lock()
+	for {
+		if elem := executor.queue.Front(); elem != nil {
+			task := executor.queue.Remove(elem).(Task)
+			executor.active++
+			executor.vacate()
+			executor.mu.Unlock()
+			run(task)
+			executor.mu.Lock()
+			executor.active--
+			executor.completed++
+			continue
+		}
+		if executor.shutdown || !executor.wait(wake, core) {
+			break
+		}
+	}
+	// the place is freed under the lock, so the next spawn does not miss it
+	_ = releaser.Release()
+	executor.running--
+	if executor.shutdown && executor.running == 0 {
+		close(executor.terminated)
+	}
+	executor.mu.Unlock()
+}
+
+// wait parks the idle worker until it is woken up or its keep-alive
+// timeout elapses. It reports whether the worker is woken up.
+// It must be called under the lock.
+func (executor *executor) wait(wake chan struct{}, core bool) bool {
+	elem := executor.idle.PushBack(wake)
+	executor.mu.Unlock()
+
+	var (
+		expired <-chan struct{}
+		ticked  <-chan time.Time
+	)
+	if !core && executor.keepalive > 0 {
+		if executor.timer != nil {
+			expired = executor.timer.After(executor.keepalive)
+		} else {
+			timer := time.NewTimer(executor.keepalive)
+			defer timer.Stop()
+			ticked = timer.C
+		}
+	}
+	select {
+	case <-wake:
+		executor.mu.Lock()
+		return true
+	case <-expired:
+	case <-ticked:
+	}
+	executor.mu.Lock()
+	select {
+	case <-wake:
+		// the worker was woken up concurrently with the timeout
+		return true
+	default:
+	}
+	executor.idle.Remove(elem)
+	return false
+}
+
+// run runs the task and passes its panic to Reject as a *PanicError,
+// so the worker survives it and the accounting stays consistent.
+func run(task Task) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			task.Reject(&PanicError{Value: recovered, Stack: debug.Stack()})
+		}
+	}()
+	task.Run()
+}
+
+// vacate wakes the callers blocked by the full queue.
+// It must be called under the lock.
+func (executor *executor) vacate() {
+	close(executor.space)
+	executor.space = make(chan struct{})
+}
+
+type future[T any] struct {
+	task  func() (T, error)
+	done  chan struct{}
+	value T
+	err   error
+}
+
+func (f *future[T]) Run() {
+	f.value, f.err = f.task()
+	close(f.done)
+}
+
+func (f *future[T]) Reject(err error) {
+	f.err = err
+	close(f.done)
+}
+
+func (f *future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+func (f *future[T]) Wait(breaker Breaker) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-done(breaker):
+		return errTimeout
+	}
+}
+
+func (f *future[T]) Result() (T, error) {
+	<-f.done
+	return f.value, f.err
+}
@@ -0,0 +1,256 @@
+package semaphore
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitForStats blocks until the stats of the executor satisfy the condition.
+func waitForStats(executor Executor, condition func(ExecutorStats) bool) {
+	for !condition(executor.Stats()) {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// occupy submits a task that blocks until the gate is closed
+// and waits until a worker runs it.
+func occupy(t *testing.T, executor Executor, gate <-chan struct{}) {
+	active := executor.Stats().Active
+	assert.NoError(t, executor.Execute(nil, TaskFunc(func() { <-gate })))
+	waitForStats(executor, func(stats ExecutorStats) bool { return stats.Active > active })
+}
+
+func TestExecutor(t *testing.T) {
+	executor := NewExecutor(WithWorkers(0, 4), WithQueueSize(16))
+
+	futures := make([]Future[int], 0, 16)
+	for i := 0; i < 16; i++ {
+		i := i
+		future, err := Submit(executor, nil, func() (int, error) { return i * i, nil })
+		assert.NoError(t, err)
+		futures = append(futures, future)
+	}
+	for i, future := range futures {
+		assert.NoError(t, future.Wait(nil))
+		result, err := future.Result()
+		assert.NoError(t, err)
+		assert.Equal(t, i*i, result)
+	}
+
+	failure := errors.New("failure")
+	future, err := Submit(executor, nil, func() (string, error) { return "", failure })
+	assert.NoError(t, err)
+	assert.Equal(t, failure, future.Wait(nil))
+
+	assert.NoError(t, executor.Shutdown(nil))
+	stats := executor.Stats()
+	assert.Equal(t, uint64(17), stats.Completed)
+	assert.Equal(t, uint32(0), stats.Workers)
+}
+
+func TestExecutor_Wait(t *testing.T) {
+	executor := NewExecutor(WithWorkers(1, 1))
+	gate := make(chan struct{})
+	future, err := Submit(executor, nil, func() (bool, error) { <-gate; return true, nil })
+	assert.NoError(t, err)
+
+	breaker := newCloser()
+	breaker.Close()
+	assert.True(t, IsTimeout(future.Wait(breaker)))
+	select {
+	case <-future.Done():
+		t.Fatal("unexpected completion")
+	default:
+	}
+
+	close(gate)
+	<-future.Done()
+	result, err := future.Result()
+	assert.NoError(t, err)
+	assert.True(t, result)
+	assert.NoError(t, executor.Shutdown(nil))
+}
+
+func TestExecutor_RejectionPolicy(t *testing.T) {
+	t.Run("block", func(t *testing.T) {
+		executor := NewExecutor(WithWorkers(1, 1), WithQueueSize(1), WithRejectionPolicy(Block))
+		gate := make(chan struct{})
+		occupy(t, executor, gate)
+		assert.NoError(t, executor.Execute(nil, TaskFunc(func() {})))
+
+		breaker := newCloser()
+		breaker.Close()
+		assert.True(t, IsTimeout(executor.Execute(breaker, TaskFunc(func() {}))))
+
+		result := make(chan error, 1)
+		go func() { result <- executor.Execute(nil, TaskFunc(func() {})) }()
+		close(gate)
+		assert.NoError(t, <-result)
+		assert.NoError(t, executor.Shutdown(nil))
+		assert.Equal(t, uint64(3), executor.Stats().Completed)
+	})
+	t.Run("drop newest", func(t *testing.T) {
+		executor := NewExecutor(WithWorkers(1, 1), WithQueueSize(1), WithRejectionPolicy(DropNewest))
+		gate := make(chan struct{})
+		occupy(t, executor, gate)
+		queued, err := Submit(executor, nil, func() (int, error) { return 1, nil })
+		assert.NoError(t, err)
+
+		_, err = Submit(executor, nil, func() (int, error) { return 2, nil })
+		assert.True(t, IsRejected(err))
+
+		close(gate)
+		result, err := queued.Result()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result)
+		assert.NoError(t, executor.Shutdown(nil))
+		assert.Equal(t, uint64(1), executor.Stats().Rejected)
+	})
+	t.Run("drop oldest", func(t *testing.T) {
+		executor := NewExecutor(WithWorkers(1, 1), WithQueueSize(1), WithRejectionPolicy(DropOldest))
+		gate := make(chan struct{})
+		occupy(t, executor, gate)
+		oldest, err := Submit(executor, nil, func() (int, error) { return 1, nil })
+		assert.NoError(t, err)
+		newest, err := Submit(executor, nil, func() (int, error) { return 2, nil })
+		assert.NoError(t, err)
+		assert.True(t, IsRejected(oldest.Wait(nil)))
+
+		close(gate)
+		result, err := newest.Result()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, result)
+		assert.NoError(t, executor.Shutdown(nil))
+		assert.Equal(t, uint64(1), executor.Stats().Rejected)
+	})
+	t.Run("caller runs", func(t *testing.T) {
+		executor := NewExecutor(WithWorkers(1, 1), WithQueueSize(0), WithRejectionPolicy(CallerRuns))
+		gate := make(chan struct{})
+		occupy(t, executor, gate)
+
+		ran := false
+		assert.NoError(t, executor.Execute(nil, TaskFunc(func() { ran = true })))
+		assert.True(t, ran)
+
+		close(gate)
+		assert.NoError(t, executor.Shutdown(nil))
+		assert.Equal(t, uint64(2), executor.Stats().Completed)
+	})
+}
+
+func TestExecutor_Autoscale(t *testing.T) {
+	timer := &manualTimer{}
+	executor := NewExecutor(WithWorkers(1, 3), WithQueueSize(0), WithKeepAlive(time.Second), WithExecutorTimer(timer))
+	assert.Equal(t, uint32(1), executor.Stats().Workers)
+
+	gate := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		occupy(t, executor, gate)
+	}
+	assert.Equal(t, uint32(3), executor.Stats().Workers)
+
+	close(gate)
+	timer.expire(2)
+	waitForStats(executor, func(stats ExecutorStats) bool { return stats.Workers == 1 })
+	assert.Equal(t, uint32(1), executor.Stats().Workers, "the core worker must be kept alive")
+	assert.NoError(t, executor.Shutdown(nil))
+}
+
+func TestExecutor_Panic(t *testing.T) {
+	executor := NewExecutor(WithWorkers(1, 1))
+	future, err := Submit(executor, nil, func() (int, error) { panic("boom") })
+	assert.NoError(t, err)
+	_, err = future.Result()
+	assert.True(t, IsPanic(err))
+	assert.Equal(t, "boom", err.(*PanicError).Value)
+
+	assert.NoError(t, executor.Execute(nil, TaskFunc(func() { panic("boom") })))
+	future, err = Submit(executor, nil, func() (int, error) { return 1, nil })
+	assert.NoError(t, err)
+	result, err := future.Result()
+	assert.NoError(t, err, "the worker must survive the panic")
+	assert.Equal(t, 1, result)
+
+	assert.NoError(t, executor.Shutdown(nil))
+	stats := executor.Stats()
+	assert.Equal(t, uint64(3), stats.Completed)
+	assert.Equal(t, uint32(0), stats.Active)
+	assert.Equal(t, uint32(0), stats.Workers)
+}
+
+func TestExecutor_Shutdown(t *testing.T) {
+	executor := NewExecutor(WithWorkers(1, 1), WithQueueSize(2))
+	gate := make(chan struct{})
+	occupy(t, executor, gate)
+	var completed int32
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, executor.Execute(nil, TaskFunc(func() { atomic.AddInt32(&completed, 1) })))
+	}
+
+	breaker := newCloser()
+	breaker.Close()
+	assert.True(t, IsTimeout(executor.Shutdown(breaker)))
+	assert.True(t, IsShutdown(executor.Execute(nil, TaskFunc(func() {}))))
+
+	close(gate)
+	assert.NoError(t, executor.Shutdown(nil))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&completed))
+	assert.Equal(t, uint32(0), executor.Stats().Workers)
+}
+
+func TestExecutor_ShutdownNow(t *testing.T) {
+	executor := NewExecutor(WithWorkers(1, 1), WithQueueSize(2))
+	gate := make(chan struct{})
+	occupy(t, executor, gate)
+	first, _ := Submit(executor, nil, func() (int, error) { return 1, nil })
+	second, _ := Submit(executor, nil, func() (int, error) { return 2, nil })
+
+	assert.Equal(t, 2, executor.ShutdownNow())
+	assert.True(t, IsShutdown(first.Wait(nil)))
+	assert.True(t, IsShutdown(second.Wait(nil)))
+	_, err := Submit(executor, nil, func() (int, error) { return 3, nil })
+	assert.True(t, IsShutdown(err))
+
+	close(gate)
+	assert.NoError(t, executor.Shutdown(nil))
+	assert.Equal(t, uint64(2), executor.Stats().Rejected)
+}
+
+// manualTimer expires the channels only on command.
+type manualTimer struct {
+	mu      sync.Mutex
+	pending []chan struct{}
+}
+
+func (timer *manualTimer) Now() time.Time { return time.Time{} }
+
+func (timer *manualTimer) After(time.Duration) <-chan struct{} {
+	ch := make(chan struct{})
+	timer.mu.Lock()
+	timer.pending = append(timer.pending, ch)
+	timer.mu.Unlock()
+	return ch
+}
+
+// expire waits until the given number of channels is pending and closes them.
+func (timer *manualTimer) expire(count int) {
+	for {
+		timer.mu.Lock()
+		if len(timer.pending) >= count {
+			for _, ch := range timer.pending {
+				close(ch)
+			}
+			timer.pending = nil
+			timer.mu.Unlock()
+			return
+		}
+		timer.mu.Unlock()
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,188 @@
+package semaphore
+
+import (
+	"container/list"
+	"math"
+	"time"
+)
+
+// Flow tags the breaker with the flow key. The semaphores constructed
+// by NewWeighted grant free places in weighted-fair order across flows
+// instead of the global arrival order. Weights of flows are set
+// by WithFlowWeight, the default weight is 1.
+//
+// The key is found through the breakers that wrap the tagged one
+// and expose it by Unwrap() Breaker or Unwrap() []Breaker,
+// like the ones returned by Multiplex.
+func Flow(breaker BreakCloser, key string) BreakCloser {
+	return flowBreaker{breaker, key}
+}
+
+// FlowStats represents a snapshot of a flow state.
+type FlowStats struct {
+	// Waiting is a current number of waiters of the flow in the queue.
+	Waiting uint32
+	// Granted is a total number of places granted to the flow.
+	Granted uint64
+}
+
+type flowBreaker struct {
+	BreakCloser
+	key string
+}
+
+func (breaker flowBreaker) Done() <-chan struct{} {
+	return done(breaker.BreakCloser)
+}
+
+func (breaker flowBreaker) Close() {
+	if breaker.BreakCloser != nil {
+		breaker.BreakCloser.Close()
+	}
+}
+
+func (breaker flowBreaker) Deadline() (time.Time, bool) {
+	return deadlineOf(breaker.BreakCloser)
+}
+
+func (breaker flowBreaker) Unwrap() Breaker {
+	return breaker.BreakCloser
+}
+
+// keyOf returns the flow key of the breaker or of the first breaker
+// wrapped by it that has one.
+func keyOf(breaker Breaker) string {
+	switch breaker := breaker.(type) {
+	case flowBreaker:
+		return breaker.key
+	case interface{ Unwrap() Breaker }:
+		return keyOf(breaker.Unwrap())
+	case interface{ Unwrap() []Breaker }:
+		for _, wrapped := range breaker.Unwrap() {
+			if key := keyOf(wrapped); key != "" {
+				return key
+			}
+		}
+	}
+	return ""
+}
+
+// flow holds the waiters with the same key in the order of their arrival.
+// Its virtual time grows by the granted places divided by the weight,
+// the active flow with the least virtual time is served first.
+// The places granted to the flow are counted by the semaphore,
+// so the totals survive when the flow is dropped.
+type flow struct {
+	key    string
+	queue  list.List
+	weight float64
+	vtime  float64
+}
+
+// flow returns the flow with the key, creating it if necessary.
+// It must be called under the lock.
+func (semaphore *draft) flow(key string) *flow {
+	if f, is := semaphore.flows[key]; is {
+		return f
+	}
+	if semaphore.flows == nil {
+		semaphore.flows = make(map[string]*flow)
+	}
+	f := &flow{key: key, weight: 1}
+	if weight, is := semaphore.weights[key]; is && weight > 0 {
+		f.weight = float64(weight)
+	}
+	semaphore.flows[key] = f
+	return f
+}
+
+// grant accounts the places granted to the flow with the key.
+// The nil flow means the places are granted without queueing,
+// so only the total is counted. It must be called under the lock.
+func (semaphore *draft) grant(key string, f *flow, size uint32) {
+	if semaphore.granted == nil {
+		semaphore.granted = make(map[string]uint64)
+	}
+	semaphore.granted[key] += uint64(size)
+	if f == nil {
+		return
+	}
+	f.vtime += float64(size) / f.weight
+	semaphore.settle(f)
+}
+
+// seize occupies the places granted without waiting. The flow is tracked
+// only if they are granted ahead of the waiters in the queue.
+// It must be called under the lock.
+func (semaphore *draft) seize(key string, size uint32, now time.Time) *releaser {
+	var f *flow
+	if semaphore.queue.Len() > 0 {
+		f = semaphore.flow(key)
+	}
+	return semaphore.occupy(key, f, size, now)
+}
+
+// settle advances the virtual time to the least one of the active flows
+// and drops the idle flows that are not ahead of it, so the flows do not
+// pile up for every key ever seen. The idle flow that is ahead is kept
+// until the others catch up, so it cannot jump the queue by going idle.
+// When no flow is active, all of them are caught up and dropped.
+// It must be called under the lock.
+func (semaphore *draft) settle(f *flow) {
+	if semaphore.queue.Len() == 0 {
+		semaphore.vtime = math.Max(semaphore.vtime, f.vtime)
+		for key, idle := range semaphore.flows {
+			semaphore.vtime = math.Max(semaphore.vtime, idle.vtime)
+			delete(semaphore.flows, key)
+		}
+		return
+	}
+
+	least := math.Inf(1)
+	for _, active := range semaphore.flows {
+		if active.queue.Len() > 0 {
+			least = math.Min(least, active.vtime)
+		}
+	}
+	if !math.IsInf(least, 1) {
+		semaphore.vtime = math.Max(semaphore.vtime, least)
+	}
+	for key, idle := range semaphore.flows {
+		if idle.queue.Len() == 0 && idle.vtime <= semaphore.vtime {
+			delete(semaphore.flows, key)
+		}
+	}
+	if f.queue.Len() > 0 || f.vtime > semaphore.vtime {
+		// the flow may be dropped by dequeue right before the grant
+		semaphore.flows[f.key] = f
+	}
+}
+
+// activate prevents the flow that was idle from accumulating credit
+// against the flows that were busy. It must be called under the lock.
+func (semaphore *draft) activate(f *flow) {
+	if f.queue.Len() == 0 && f.vtime < semaphore.vtime {
+		f.vtime = semaphore.vtime
+	}
+}
+
+// pick returns the active flow with the least virtual time,
+// ties are broken by the arrival of the oldest waiter.
+// It must be called under the lock.
+func (semaphore *draft) pick() *flow {
+	var (
+		picked *flow
+		since  time.Time
+	)
+	for _, f := range semaphore.flows {
+		head := f.queue.Front()
+		if head == nil {
+			continue
+		}
+		arrival := head.Value.(*list.Element).Value.(*waiter).since
+		if picked == nil || f.vtime < picked.vtime || f.vtime == picked.vtime && arrival.Before(since) {
+			picked, since = f, arrival
+		}
+	}
+	return picked
+}
@@ -0,0 +1,115 @@
+package semaphore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlow(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		options  []Option
+		arrivals string
+		expected string
+	}{
+		{name: "noisy neighbour", arrivals: "aaaaab", expected: "abaaaa"},
+		{name: "weighted", options: []Option{WithFlowWeight("a", 3)}, arrivals: "aaaabbbb", expected: "abaaabbb"},
+		{name: "wrapped", arrivals: "aaaaaB", expected: "aBaaaa"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			semaphore := NewWeighted(1, tc.options...)
+			releaser, _ := semaphore.Acquire(nil)
+
+			type admission struct {
+				key      string
+				releaser Releaser
+			}
+			admitted := make(chan admission)
+			for i, key := range tc.arrivals {
+				go func(key string) {
+					breaker := Flow(nil, strings.ToLower(key))
+					if key != strings.ToLower(key) {
+						breaker = Multiplex(breaker)
+					}
+					releaser, _ := semaphore.Acquire(breaker)
+					admitted <- admission{key, releaser}
+				}(string(key))
+				waitFor(semaphore, uint32(i+1))
+			}
+			arrivals := strings.ToLower(tc.arrivals)
+			assert.Equal(t, uint32(strings.Count(arrivals, "b")), semaphore.Stats().Flows["b"].Waiting)
+
+			obtained := ""
+			for range tc.arrivals {
+				assert.NoError(t, releaser.Release())
+				next := <-admitted
+				obtained, releaser = obtained+next.key, next.releaser
+				if len(obtained) == 1 {
+					expected := uint32(strings.Count(arrivals, "a") - 1)
+					assert.Equal(t, FlowStats{Waiting: expected, Granted: 1}, semaphore.Stats().Flows["a"])
+				}
+			}
+			assert.NoError(t, releaser.Release())
+			assert.Equal(t, tc.expected, obtained)
+
+			stats := semaphore.Stats()
+			assert.Equal(t, uint32(0), stats.Waiting)
+			assert.Equal(t, FlowStats{Granted: uint64(strings.Count(arrivals, "a"))}, stats.Flows["a"])
+			assert.Equal(t, FlowStats{Granted: uint64(strings.Count(arrivals, "b"))}, stats.Flows["b"])
+			assert.Empty(t, semaphore.(*draft).flows, "the idle flows must be dropped")
+		})
+	}
+}
+
+func TestFlow_VirtualTime(t *testing.T) {
+	semaphore := NewWeighted(1, WithFlowWeight("b", 4))
+	releaser, _ := semaphore.Acquire(nil)
+
+	type admission struct {
+		key      string
+		releaser Releaser
+	}
+	admitted := make(chan admission)
+	arrive := func(key string) {
+		waiting := semaphore.Stats().Waiting
+		go func() {
+			releaser, _ := semaphore.Acquire(Flow(nil, key))
+			admitted <- admission{key, releaser}
+		}()
+		waitFor(semaphore, waiting+1)
+	}
+	for _, key := range "aabbbb" {
+		arrive(string(key))
+	}
+
+	assert.NoError(t, releaser.Release())
+	next := <-admitted
+	obtained, releaser := next.key, next.releaser
+	// the new flow starts at the least virtual time of the active flows,
+	// not at the virtual time of the flow granted last
+	arrive("c")
+	for len(obtained) < 7 {
+		assert.NoError(t, releaser.Release())
+		next := <-admitted
+		obtained, releaser = obtained+next.key, next.releaser
+	}
+	assert.NoError(t, releaser.Release())
+	assert.Equal(t, "abcbbba", obtained)
+}
+
+func TestFlow_Idle(t *testing.T) {
+	semaphore := NewWeighted(1)
+	for i := 0; i < 100; i++ {
+		releaser, err := semaphore.Acquire(Flow(nil, strings.Repeat("x", i)))
+		assert.NoError(t, err)
+		assert.NoError(t, releaser.Release())
+	}
+	flows := semaphore.Stats().Flows
+	assert.Len(t, flows, 100)
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, FlowStats{Granted: 1}, flows[strings.Repeat("x", i)], "the totals must be kept")
+	}
+	assert.Empty(t, semaphore.(*draft).flows, "the flows of the keys not in use must be dropped")
+}
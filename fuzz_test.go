@@ -0,0 +1,244 @@
+package semaphore
+
+import (
+	"context"
+	"runtime"
+	"testing"
+)
+
+// The fuzz targets decode the input as the capacity followed by pairs
+// of an operation and its argument. They compare the semaphore
+// with the sequential model after every step. A failing input
+// is minimized by the fuzzing engine and stored in testdata/fuzz,
+// where it is run as a regression test by go test.
+// Long inputs are skipped to keep every run fast.
+
+const fuzzLimit = 1 + 2*64
+
+const (
+	fuzzAcquire = iota
+	fuzzTry
+	fuzzRelease
+	fuzzResize
+	fuzzCancel
+	fuzzOperations
+)
+
+type model struct {
+	capacity, occupied uint32
+}
+
+func (m *model) fits(size uint32) bool {
+	return uint64(m.occupied)+uint64(size) <= uint64(m.capacity)
+}
+
+func (m *model) occupy(size uint32) {
+	m.occupied += size
+}
+
+func (m *model) free(size uint32) {
+	if size > m.occupied {
+		size = m.occupied
+	}
+	m.occupied -= size
+}
+
+type modelHolder struct {
+	places   uint32
+	released bool
+}
+
+func seed(f *testing.F) {
+	f.Add([]byte{2, fuzzAcquire, 1, fuzzAcquire, 1, fuzzTry, 1, fuzzRelease, 0, fuzzTry, 1})
+	f.Add([]byte{3, fuzzTry, 2, fuzzCancel, 2, fuzzRelease, 0, fuzzRelease, 0, fuzzCancel, 3})
+	f.Add([]byte{4, fuzzAcquire, 3, fuzzResize, 2, fuzzTry, 1, fuzzRelease, 0, fuzzResize, 0})
+	f.Add([]byte{1, fuzzRelease, 0, fuzzAcquire, 0, fuzzRelease, 1, fuzzRelease, 1})
+}
+
+func FuzzWeighted(f *testing.F) {
+	seed(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 || len(data) > fuzzLimit {
+			return
+		}
+		m := model{capacity: uint32(data[0]%8) + 1}
+		semaphore := NewWeighted(m.capacity)
+		var (
+			holders []Releaser
+			states  []*modelHolder
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		broken := breaker{ctx}
+
+		for i := 1; i+1 < len(data); i += 2 {
+			op, arg := data[i]%fuzzOperations, data[i+1]
+			size := uint32(arg%4) + 1
+			switch op {
+			case fuzzAcquire:
+				releaser, err := semaphore.Acquire(broken, size)
+				if m.fits(size) {
+					if err != nil {
+						t.Fatalf("step %d: acquire %d: unexpected error: %v", i/2, size, err)
+					}
+					m.occupy(size)
+					holders, states = append(holders, releaser), append(states, &modelHolder{places: size})
+				} else if !IsTimeout(err) {
+					t.Fatalf("step %d: acquire %d: expected timeout, obtained: %v", i/2, size, err)
+				}
+			case fuzzTry:
+				releaser, err := semaphore.Try(nil, size)
+				if m.fits(size) {
+					if err != nil {
+						t.Fatalf("step %d: try %d: unexpected error: %v", i/2, size, err)
+					}
+					m.occupy(size)
+					holders, states = append(holders, releaser), append(states, &modelHolder{places: size})
+				} else if !IsNoPlace(err) {
+					t.Fatalf("step %d: try %d: expected no place, obtained: %v", i/2, size, err)
+				}
+			case fuzzRelease:
+				if len(holders) == 0 {
+					if err := semaphore.Release(); !IsEmpty(err) {
+						t.Fatalf("step %d: release: expected empty, obtained: %v", i/2, err)
+					}
+					break
+				}
+				index := int(arg) % len(holders)
+				err, state := holders[index].Release(), states[index]
+				if state.released {
+					if !IsEmpty(err) {
+						t.Fatalf("step %d: release twice: expected empty, obtained: %v", i/2, err)
+					}
+					break
+				}
+				if err != nil {
+					t.Fatalf("step %d: release: unexpected error: %v", i/2, err)
+				}
+				state.released = true
+				m.free(state.places)
+			case fuzzResize:
+				capacity := uint32(arg % 8)
+				if previous := semaphore.Size(capacity); previous != m.capacity {
+					t.Fatalf("step %d: resize: expected previous %d, obtained: %d", i/2, m.capacity, previous)
+				}
+				if capacity != 0 {
+					m.capacity = capacity
+				}
+			case fuzzCancel:
+				ctx, cancel := context.WithCancel(context.Background())
+				done := make(chan error, 1)
+				go func() {
+					releaser, err := semaphore.Acquire(breaker{ctx}, size)
+					if err == nil {
+						err = releaser.Release()
+					}
+					done <- err
+				}()
+				if m.fits(size) {
+					if err := <-done; err != nil {
+						t.Fatalf("step %d: cancel %d: unexpected error: %v", i/2, size, err)
+					}
+					cancel()
+					break
+				}
+				waitFor(semaphore, 1)
+				cancel()
+				if err := <-done; !IsTimeout(err) {
+					t.Fatalf("step %d: cancel %d: expected timeout, obtained: %v", i/2, size, err)
+				}
+			}
+
+			if occupied := semaphore.Peek(); occupied != m.occupied {
+				t.Fatalf("step %d: expected %d occupied places, obtained: %d", i/2, m.occupied, occupied)
+			}
+			if stats := semaphore.Stats(); stats.Waiting != 0 || stats.Capacity != m.capacity {
+				t.Fatalf("step %d: unexpected stats: %+v", i/2, stats)
+			}
+		}
+	})
+}
+
+func FuzzSemaphore(f *testing.F) {
+	seed(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 || len(data) > fuzzLimit {
+			return
+		}
+		m := model{capacity: uint32(data[0]%8) + 1}
+		semaphore := New(int(m.capacity))
+		var holders []ReleaseFunc
+
+		for i := 1; i+1 < len(data); i += 2 {
+			op, arg := data[i]%fuzzOperations, data[i+1]
+			switch op {
+			case fuzzAcquire, fuzzTry:
+				var (
+					release ReleaseFunc
+					err     error
+				)
+				if op == fuzzAcquire {
+					release, err = semaphore.Acquire(closedchan)
+				} else {
+					release, err = semaphore.Catch()
+				}
+				if m.fits(1) {
+					if err != nil {
+						t.Fatalf("step %d: acquire: unexpected error: %v", i/2, err)
+					}
+					m.occupy(1)
+					holders = append(holders, release)
+				} else if op == fuzzAcquire && !IsTimeout(err) {
+					t.Fatalf("step %d: acquire: expected timeout, obtained: %v", i/2, err)
+				} else if op == fuzzTry && !IsNoPlace(err) {
+					t.Fatalf("step %d: catch: expected no place, obtained: %v", i/2, err)
+				}
+			case fuzzRelease:
+				if len(holders) == 0 {
+					if err := semaphore.Release(); !IsEmpty(err) {
+						t.Fatalf("step %d: release: expected empty, obtained: %v", i/2, err)
+					}
+					break
+				}
+				// every call of a release function frees one slot
+				holders[int(arg)%len(holders)]()
+				m.free(1)
+			case fuzzResize:
+				if capacity := semaphore.Capacity(); capacity != int(m.capacity) {
+					t.Fatalf("step %d: expected capacity %d, obtained: %d", i/2, m.capacity, capacity)
+				}
+			case fuzzCancel:
+				deadline := make(chan struct{})
+				done := make(chan error, 1)
+				go func() {
+					release, err := semaphore.Acquire(deadline)
+					if err == nil {
+						release()
+					}
+					done <- err
+				}()
+				if m.fits(1) {
+					if err := <-done; err != nil {
+						t.Fatalf("step %d: cancel: unexpected error: %v", i/2, err)
+					}
+					close(deadline)
+					break
+				}
+				for semaphore.Waiting() != 1 {
+					runtime.Gosched()
+				}
+				close(deadline)
+				if err := <-done; !IsTimeout(err) {
+					t.Fatalf("step %d: cancel: expected timeout, obtained: %v", i/2, err)
+				}
+			}
+
+			if occupied := semaphore.Occupied(); occupied != int(m.occupied) {
+				t.Fatalf("step %d: expected %d occupied slots, obtained: %d", i/2, m.occupied, occupied)
+			}
+			if waiting := semaphore.Waiting(); waiting != 0 {
+				t.Fatalf("step %d: expected no waiting goroutines, obtained: %d", i/2, waiting)
+			}
+		}
+	})
+}
@@ -0,0 +1,294 @@
+package semaphore
+
+import (
+	"container/list"
+	"time"
+)
+
+// A Holder is a Releaser that can adjust the number of places it holds
+// and be handed to another owner. The Releasers returned by
+// the semaphores constructed by NewWeighted implement it.
+type Holder interface {
+	Releaser
+	// Places returns a current number of places held by the Holder.
+	Places() uint32
+	// Shrink releases the given number of places and keeps the rest.
+	// If it holds less places, then it returns an appropriate error.
+	Shrink(uint32) error
+	// Grow occupies the given number of places in addition to the held ones.
+	// The operation can be canceled using breaker. In this case,
+	// it returns an appropriate error and the held places remain.
+	// If the held and the given places exceed the capacity,
+	// it returns an appropriate error without waiting.
+	Grow(BreakCloser, uint32) error
+	// Owner returns the owner of the Holder, it is empty by default.
+	Owner() string
+	// Handoff transfers the held places to the new owner and returns
+	// the Holder for it. The current Holder becomes released
+	// without releasing the places.
+	Handoff(owner string) (Holder, error)
+	// Swap atomically exchanges the held places for the given number
+	// of places in the target semaphore: there is no moment when
+	// both or neither of them are held. It waits in the queue of the target
+	// like Acquire, and the exchange happens when the target serves it.
+	// The operation can be canceled using breaker. In this case,
+	// it returns an appropriate error and the held places remain.
+	//
+	// If the target is not constructed by NewWeighted, the places
+	// are occupied in it before the held ones are released.
+	Swap(breaker BreakCloser, target Interface, places ...uint32) (Releaser, error)
+}
+
+// HolderStats represents a snapshot of an active holder.
+type HolderStats struct {
+	// Owner is the owner of the holder.
+	Owner string
+	// Places is a current number of places held by the holder.
+	Places uint32
+	// Since is the time when the places were occupied.
+	Since time.Time
+}
+
+type releaser struct {
+	semaphore *draft
+	elem      *list.Element
+	owner     string
+	places    uint32
+	since     time.Time
+	closer    BreakCloser
+	lease     *list.Element
+	released  bool
+}
+
+func (releaser *releaser) Release() error {
+	semaphore, now := releaser.semaphore, releaser.semaphore.now()
+	semaphore.lock()
+	closer, err := releaser.closer, errEmpty
+	if !releaser.released {
+		semaphore.forget(releaser)
+		err = semaphore.vacate(releaser.places, releaser.since, now)
+	}
+	semaphore.unlock()
+	if closer != nil {
+		closer.Close()
+	}
+	return err
+}
+
+func (releaser *releaser) Places() uint32 {
+	releaser.semaphore.lock()
+	defer releaser.semaphore.unlock()
+	if releaser.released {
+		return 0
+	}
+	return releaser.places
+}
+
+func (releaser *releaser) Shrink(places uint32) error {
+	semaphore := releaser.semaphore
+	semaphore.lock()
+	defer semaphore.unlock()
+	if releaser.released || places > releaser.places {
+		return errEmpty
+	}
+	if places == 0 {
+		return nil
+	}
+	releaser.places -= places
+	if releaser.places == 0 {
+		semaphore.forget(releaser)
+	}
+	return semaphore.vacate(places, time.Time{}, time.Time{})
+}
+
+func (releaser *releaser) Grow(breaker BreakCloser, places uint32) error {
+	if places == 0 {
+		return nil
+	}
+	semaphore := releaser.semaphore
+	semaphore.lock()
+	exceeds := uint64(releaser.places)+uint64(places) > uint64(semaphore.capacity)
+	semaphore.unlock()
+	if exceeds {
+		// the request can never be satisfied, so it must not wait
+		return errNoPlace
+	}
+	extra, err := semaphore.acquire(breaker, places, places)
+	if err != nil {
+		return err
+	}
+
+	semaphore.lock()
+	defer semaphore.unlock()
+	semaphore.forget(extra)
+	if releaser.released {
+		_ = semaphore.vacate(places, time.Time{}, time.Time{})
+		return errEmpty
+	}
+	releaser.places += places
+	return nil
+}
+
+func (releaser *releaser) Owner() string {
+	releaser.semaphore.lock()
+	defer releaser.semaphore.unlock()
+	return releaser.owner
+}
+
+func (releaser *releaser) Handoff(owner string) (Holder, error) {
+	semaphore := releaser.semaphore
+	semaphore.lock()
+	defer semaphore.unlock()
+	if releaser.released {
+		return nil, errEmpty
+	}
+	next := *releaser
+	next.owner = owner
+	next.elem.Value = &next
+	semaphore.rebind(releaser, &next)
+	releaser.released, releaser.closer = true, nil
+	return &next, nil
+}
+
+func (releaser *releaser) Swap(breaker BreakCloser, target Interface, places ...uint32) (Releaser, error) {
+	to, is := target.(*draft)
+	if !is {
+		next, err := target.Acquire(breaker, places...)
+		if err != nil {
+			return nil, err
+		}
+		if err = releaser.Release(); err != nil {
+			_ = next.Release()
+			return nil, err
+		}
+		return next, nil
+	}
+
+	from, size := releaser.semaphore, reduce(places...)
+	if from == to {
+		return releaser.resize(breaker, size)
+	}
+	select {
+	case <-done(breaker):
+		return nil, errTimeout
+	default:
+	}
+
+	w := &waiter{places: size, upto: size, since: to.now(), ready: make(chan struct{}), swap: true}
+	unlock := lockBoth(from, to)
+	next, elem, err := releaser.swap(breaker, to, w, nil)
+	unlock()
+	for next == nil && err == nil {
+		select {
+		case <-w.ready:
+		case <-done(breaker):
+			to.lock()
+			if w.err == nil {
+				to.dequeue(elem)
+				to.notify()
+			}
+			err = w.err
+			to.unlock()
+			if err == nil {
+				err = errTimeout
+			}
+			return nil, err
+		}
+		unlock = lockBoth(from, to)
+		next, elem, err = releaser.swap(breaker, to, w, elem)
+		unlock()
+	}
+	return next, err
+}
+
+// swap exchanges the held places for the places of the waiter in the target
+// when it is the turn of the waiter, otherwise it puts the waiter
+// in the queue of the target or leaves it there to be woken again.
+// It must be called under the locks of both semaphores.
+func (releaser *releaser) swap(breaker Breaker, to *draft, w *waiter, elem *list.Element) (*releaser, *list.Element, error) {
+	from, now := releaser.semaphore, to.now()
+	if w.err != nil {
+		return nil, elem, w.err
+	}
+	if releaser.released {
+		if elem != nil {
+			to.dequeue(elem)
+			to.notify()
+		}
+		return nil, elem, errEmpty
+	}
+	if elem == nil {
+		if to.closed {
+			return nil, nil, errClosed
+		}
+		if !to.admits(w.places, now) {
+			if to.waiters > 0 && to.queue.Len() >= to.waiters {
+				return nil, nil, errQueueFull
+			}
+			if err := to.estimate(breaker, w.places, now); err != nil {
+				return nil, nil, err
+			}
+			w.flow = to.flow(keyOf(breaker))
+			elem = to.enqueue(w)
+			to.notify()
+			return nil, elem, nil
+		}
+		w.releaser = to.seize(keyOf(breaker), w.places, now)
+	} else {
+		if to.next(now) != elem || !to.fits(w.places) {
+			// the places are taken back, e.g., by a new size of the target
+			w.ready, w.alerted = make(chan struct{}), false
+			return nil, elem, nil
+		}
+		to.dequeue(elem)
+		if to.codel != nil {
+			to.codel.observe(now, now.Sub(w.since))
+		}
+		w.releaser = to.occupy(w.flow.key, w.flow, w.places, now)
+	}
+
+	next := w.releaser
+	next.owner, next.closer = releaser.owner, releaser.closer
+	releaser.closer = nil
+	from.forget(releaser)
+	from.free(releaser.places)
+	if to.autorelease && done(next.closer) != nil {
+		next.lease = to.lease(&binding{next.closer, next})
+	}
+	from.notify()
+	to.notify()
+	return next, elem, nil
+}
+
+// lockBoth locks the semaphores in the order of their construction
+// and returns the function that unlocks them.
+func lockBoth(a, b *draft) (unlock func()) {
+	if b.id < a.id {
+		a, b = b, a
+	}
+	a.lock()
+	b.lock()
+	return func() {
+		b.unlock()
+		a.unlock()
+	}
+}
+
+// resize exchanges the held places for the given number of places
+// in the same semaphore, growing them through its queue if necessary.
+func (releaser *releaser) resize(breaker BreakCloser, size uint32) (Releaser, error) {
+	places := releaser.Places()
+	if places == 0 {
+		return nil, errEmpty
+	}
+	var err error
+	if size > places {
+		err = releaser.Grow(breaker, size-places)
+	} else {
+		err = releaser.Shrink(places - size)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return releaser.Handoff(releaser.Owner())
+}
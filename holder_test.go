@@ -0,0 +1,162 @@
+package semaphore
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHolder_Shrink(t *testing.T) {
+	semaphore := NewWeighted(8)
+	releaser, _ := semaphore.Acquire(nil, 8)
+	holder := releaser.(Holder)
+
+	done := make(chan Releaser)
+	go func() {
+		releaser, _ := semaphore.Acquire(nil, 6)
+		done <- releaser
+	}()
+	waitFor(semaphore, 1)
+
+	assert.NoError(t, holder.Shrink(6))
+	assert.Equal(t, uint32(2), holder.Places())
+	other := <-done
+	assert.Equal(t, uint32(8), semaphore.Peek())
+
+	assert.True(t, IsEmpty(holder.Shrink(3)))
+	assert.NoError(t, holder.Shrink(2))
+	assert.True(t, IsEmpty(holder.Release()))
+	assert.NoError(t, other.Release())
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestHolder_Grow(t *testing.T) {
+	semaphore := NewWeighted(4)
+	releaser, _ := semaphore.Acquire(nil, 2)
+	holder := releaser.(Holder)
+
+	assert.NoError(t, holder.Grow(nil, 2))
+	assert.Equal(t, uint32(4), holder.Places())
+	assert.Equal(t, uint32(4), semaphore.Peek())
+
+	assert.True(t, IsNoPlace(holder.Grow(nil, 1)), "the request above the capacity must not wait")
+	assert.Equal(t, uint32(4), holder.Places())
+
+	assert.NoError(t, holder.Shrink(1))
+	other, _ := semaphore.Acquire(nil, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.True(t, IsTimeout(holder.Grow(&breaker{ctx}, 1)))
+	assert.Equal(t, uint32(3), holder.Places())
+	assert.NoError(t, other.Release())
+	assert.NoError(t, holder.Grow(nil, 1))
+	assert.Equal(t, uint32(4), holder.Places())
+
+	assert.NoError(t, holder.Release())
+	assert.Equal(t, uint32(0), holder.Places())
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestHolder_Handoff(t *testing.T) {
+	semaphore := NewWeighted(3)
+	releaser, _ := semaphore.Acquire(nil, 2)
+
+	holder, err := releaser.(Holder).Handoff("acceptor")
+	assert.NoError(t, err)
+	holder, err = holder.Handoff("worker")
+	assert.NoError(t, err)
+	assert.Equal(t, "worker", holder.Owner())
+
+	holders := semaphore.Stats().Holders
+	if assert.Len(t, holders, 1) {
+		assert.Equal(t, "worker", holders[0].Owner)
+		assert.Equal(t, uint32(2), holders[0].Places)
+	}
+
+	assert.True(t, IsEmpty(releaser.Release()), "the handed Holder must not release the places")
+	_, err = releaser.(Holder).Handoff("thief")
+	assert.True(t, IsEmpty(err))
+	assert.Equal(t, uint32(2), semaphore.Peek())
+	assert.NoError(t, holder.Release())
+	assert.Equal(t, uint32(0), semaphore.Peek())
+	assert.Empty(t, semaphore.Stats().Holders)
+}
+
+func TestHolder_Swap(t *testing.T) {
+	parse, execute := NewWeighted(1), NewWeighted(2)
+	releaser, _ := parse.Acquire(nil)
+	holder, _ := releaser.(Holder).Handoff("request")
+	busy, _ := execute.Acquire(nil, 2)
+
+	queued := make(chan Releaser)
+	go func() {
+		releaser, _ := execute.Acquire(nil)
+		queued <- releaser
+	}()
+	waitFor(execute, 1)
+
+	done := make(chan Releaser)
+	go func() {
+		releaser, _ := holder.Swap(nil, execute, 2)
+		done <- releaser
+	}()
+	waitFor(execute, 2)
+	assert.Equal(t, uint32(1), parse.Peek(), "the places must be held while waiting")
+
+	assert.NoError(t, busy.(Holder).Shrink(1))
+	first := <-queued
+	assert.Equal(t, uint32(1), parse.Peek(), "the swap must wait in the queue")
+	assert.NoError(t, first.Release())
+	assert.NoError(t, busy.Release())
+	swapped := <-done
+	assert.Equal(t, uint32(0), parse.Peek())
+	assert.Equal(t, uint32(2), execute.Peek())
+	assert.Equal(t, "request", swapped.(Holder).Owner())
+	assert.True(t, IsEmpty(holder.Release()))
+
+	swapped, err := swapped.(Holder).Swap(nil, execute, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), execute.Peek())
+	swapped, err = swapped.(Holder).Swap(nil, parse)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), parse.Peek())
+	assert.Equal(t, uint32(0), execute.Peek())
+	assert.Equal(t, "request", swapped.(Holder).Owner())
+	assert.NoError(t, swapped.Release())
+	assert.Equal(t, uint32(0), parse.Peek())
+}
+
+func TestHolder_Swap_Atomic(t *testing.T) {
+	parse, execute := NewWeighted(1), NewWeighted(2)
+	for i := 0; i < 100; i++ {
+		releaser, _ := parse.Acquire(nil)
+		busy, _ := execute.Acquire(nil, 2)
+
+		done := make(chan Releaser)
+		go func() {
+			releaser, _ := releaser.(Holder).Swap(nil, execute, 2)
+			done <- releaser
+		}()
+		waitFor(execute, 1)
+		assert.NoError(t, busy.Release())
+
+		var swapped Releaser
+		for swapped == nil {
+			unlock := lockBoth(parse.(*draft), execute.(*draft))
+			source, target := parse.Peek() == 1, execute.Peek() == 2 && execute.(*draft).queue.Len() == 0
+			unlock()
+			if !assert.NotEqual(t, source, target, "both or neither of the places are held") {
+				return
+			}
+			select {
+			case swapped = <-done:
+			default:
+				runtime.Gosched()
+			}
+		}
+		assert.Equal(t, uint32(0), parse.Peek())
+		assert.NoError(t, swapped.Release())
+	}
+}
@@ -18,6 +18,14 @@ type BreakCloser interface {
 	Close()
 }
 
+// An Interrupter is a BreakCloser that reports the reason it fired.
+type Interrupter interface {
+	BreakCloser
+	// Err returns nil if the Done channel is not yet closed.
+	// Otherwise, it returns the reason why the Interrupter fired.
+	Err() error
+}
+
 // A Releaser provides a possibility to release resources that it holds.
 type Releaser interface {
 	// Release releases resources associated with the Releaser.
@@ -30,11 +38,57 @@ type Interface interface {
 	Releaser
 
 	Acquire(BreakCloser, ...uint32) (Releaser, error)
+	// AcquireUpTo waits until at least min places are free and occupies
+	// as many of them as possible up to max. It returns the number
+	// of occupied places and the Releaser that holds exactly them.
+	AcquireUpTo(breaker BreakCloser, min, max uint32) (uint32, Releaser, error)
 	Try(Breaker, ...uint32) (Releaser, error)
+	// Signal returns a channel to send to it the Releaser only if
+	// the place is occupied. The waiter is served by the semaphore itself,
+	// a goroutine is spawned only to watch the breaker that can fire.
+	// If the breaker fires before the place is occupied, the channel
+	// is closed without a value, and if the Releaser is still not received,
+	// it is released. Both happen shortly after the breaker fires.
 	Signal(Breaker) <-chan Releaser
 
 	Peek() uint32
-	Size(uint) uint32
+	Size(uint32) uint32
+	Stats() Stats
+
+	// Wait blocks until the given number of places is free without occupying them.
+	// The operation can be canceled using breaker. In this case,
+	// it returns an appropriate error.
+	Wait(Breaker, ...uint32) error
+	// Available returns a channel that's closed when the given number
+	// of places is free or the semaphore is closed. The places are not occupied.
+	// If the breaker fires before, the channel is forgotten by the semaphore
+	// and never closed, so the caller should also select on the breaker.
+	Available(Breaker, ...uint32) <-chan struct{}
+
+	// Close fails all current and future waiters with an appropriate error.
+	// The occupied places can be released as usual.
+	Close() error
+	// Drain blocks until all occupied places are released and returns
+	// the number of holders that are still active if the operation
+	// is canceled using breaker. It is intended to be called after Close.
+	Drain(Breaker) (uint32, error)
+}
+
+// Stats represents a snapshot of a semaphore state.
+type Stats struct {
+	// Capacity is a current capacity of a semaphore.
+	Capacity uint32
+	// Occupied is a current number of occupied places.
+	Occupied uint32
+	// Waiting is a current number of waiters in the queue.
+	Waiting uint32
+	// Dropped is a total number of waiters shed by the admission policy.
+	Dropped uint64
+	// Flows are snapshots of flows by their keys, of every key
+	// that has been granted places or has waiters.
+	Flows map[string]FlowStats
+	// Holders are snapshots of active holders in the order of acquisition.
+	Holders []HolderStats
 }
 
 // Semaphore provides the functionality of the same named pattern.
@@ -49,8 +103,17 @@ type Semaphore interface {
 	Acquire(deadline <-chan struct{}) (ReleaseFunc, error)
 	// Catch tries to reduce the number of available slots for 1.
 	Catch() (ReleaseFunc, error)
+	// Close fails all current and future calls of Acquire and Catch
+	// with an appropriate error. The occupied slots can be released as usual.
+	Close() error
+	// Drain blocks until all occupied slots are released and returns
+	// the number of slots that are still occupied if the operation
+	// is canceled using deadline. It is intended to be called after Close.
+	Drain(deadline <-chan struct{}) (int, error)
 	// Signal returns a channel to send to it release function
 	// only if Acquire is successful. In any case, the channel will be closed.
+	// The release function not received before the deadline is called
+	// automatically. See Interface.Signal for details.
 	Signal(deadline <-chan struct{}) <-chan ReleaseFunc
 }
 
@@ -63,4 +126,7 @@ type HealthChecker interface {
 	// Occupied returns a current number of occupied slots.
 	// It must be safe to call Occupied concurrently on a single semaphore.
 	Occupied() int
+	// Waiting returns a current number of goroutines waiting for a slot.
+	// It must be safe to call Waiting concurrently on a single semaphore.
+	Waiting() int
 }
@@ -0,0 +1,130 @@
+package semaphore
+
+import "container/list"
+
+// A lease ties something held by the semaphore to a breaker.
+// Every lease is reaped by its own goroutine that watches the breaker
+// until it fires or the lease ends, so the cost of a lease is bounded.
+type lease interface {
+	breaker() Breaker
+	// reap reports whether the lease is over and can be forgotten.
+	// It must be called under the lock.
+	reap(*draft) bool
+}
+
+// binding ties the occupied places to the lifetime of the breaker.
+type binding struct {
+	source   BreakCloser
+	releaser *releaser
+}
+
+func (binding *binding) breaker() Breaker {
+	return binding.source
+}
+
+func (binding *binding) reap(semaphore *draft) bool {
+	if binding.releaser.released {
+		return true
+	}
+	if !fired(binding.source) {
+		return false
+	}
+	semaphore.expire(binding.releaser)
+	return true
+}
+
+// bind releases the places when the breaker fires.
+func (semaphore *draft) bind(breaker BreakCloser, releaser *releaser) {
+	if breaker == nil {
+		return
+	}
+	semaphore.lock()
+	defer semaphore.unlock()
+	releaser.closer = breaker
+	if done(breaker) != nil {
+		releaser.lease = semaphore.lease(&binding{breaker, releaser})
+	}
+}
+
+// rebind moves the lease of the Releaser to its successor.
+// It must be called under the lock.
+func (semaphore *draft) rebind(releaser, successor *releaser) {
+	if releaser.lease == nil {
+		return
+	}
+	if binding, is := releaser.lease.Value.(*watched).lease.(*binding); is && binding.releaser == releaser {
+		binding.releaser = successor
+	}
+}
+
+// expire releases the places of the Releaser that is out of its lease.
+// It must be called under the lock.
+func (semaphore *draft) expire(releaser *releaser) {
+	if releaser.released {
+		return
+	}
+	semaphore.forget(releaser)
+	semaphore.free(releaser.places)
+}
+
+// watched is the lease in the list of the semaphore
+// with the channel that stops its goroutine.
+type watched struct {
+	lease
+	stop chan struct{}
+}
+
+// lease adds the lease and starts the goroutine that reaps it
+// when its breaker fires. It must be called under the lock.
+func (semaphore *draft) lease(lease lease) *list.Element {
+	w := &watched{lease: lease, stop: make(chan struct{})}
+	elem := semaphore.leases.PushBack(w)
+	go semaphore.guard(elem, w)
+	return elem
+}
+
+// unlease forgets the lease and stops its goroutine.
+// It must be called under the lock.
+func (semaphore *draft) unlease(elem *list.Element) {
+	if elem == nil {
+		return
+	}
+	w := elem.Value.(*watched)
+	select {
+	case <-w.stop:
+		return
+	default:
+	}
+	semaphore.leases.Remove(elem)
+	close(w.stop)
+}
+
+// guard waits until the breaker of the lease fires and reaps it.
+// It exits as soon as the lease ends.
+func (semaphore *draft) guard(elem *list.Element, w *watched) {
+	select {
+	case <-done(w.breaker()):
+	case <-w.stop:
+		return
+	}
+	semaphore.lock()
+	defer semaphore.unlock()
+	select {
+	case <-w.stop:
+		return
+	default:
+	}
+	if w.reap(semaphore) {
+		semaphore.unlease(elem)
+	}
+	semaphore.notify()
+}
+
+func fired(breaker Breaker) bool {
+	select {
+	case <-done(breaker):
+		return true
+	default:
+		return false
+	}
+}
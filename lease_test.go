@@ -0,0 +1,101 @@
+package semaphore
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDraft_AutoRelease(t *testing.T) {
+	semaphore := NewWeighted(1, WithAutoRelease())
+
+	request := newCloser()
+	forgotten, err := semaphore.Acquire(request)
+	assert.NoError(t, err)
+
+	done := make(chan Releaser)
+	go func() {
+		releaser, _ := semaphore.Acquire(nil)
+		done <- releaser
+	}()
+	waitFor(semaphore, 1)
+	request.cancel()
+
+	assert.NoError(t, (<-done).Release(), "the place must be released with the breaker")
+	assert.True(t, IsEmpty(forgotten.Release()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&request.closed))
+
+	request = newCloser()
+	releaser, err := semaphore.Acquire(request)
+	assert.NoError(t, err)
+	assert.NoError(t, releaser.Release())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&request.closed), "the breaker must be closed with the Releaser")
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+type closer struct {
+	context.Context
+	cancel context.CancelFunc
+	closed int32
+}
+
+func newCloser() *closer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &closer{Context: ctx, cancel: cancel}
+}
+
+func (closer *closer) Close() {
+	atomic.AddInt32(&closer.closed, 1)
+	closer.cancel()
+}
+
+func TestDraft_AutoRelease_Unordered(t *testing.T) {
+	semaphore := NewWeighted(2, WithAutoRelease())
+
+	first, second := newCloser(), newCloser()
+	_, err := semaphore.Acquire(first)
+	assert.NoError(t, err)
+	_, err = semaphore.Acquire(second)
+	assert.NoError(t, err)
+
+	done := make(chan Releaser)
+	go func() {
+		releaser, _ := semaphore.Acquire(nil)
+		done <- releaser
+	}()
+	waitFor(semaphore, 1)
+	second.cancel()
+
+	releaser := <-done
+	assert.Equal(t, uint32(2), semaphore.Peek(), "the place of the second lease must be released")
+	first.cancel()
+	assert.NoError(t, releaser.Release())
+	for semaphore.Peek() != 0 {
+		runtime.Gosched()
+	}
+}
+
+func TestDraft_AutoRelease_Many(t *testing.T) {
+	const leases = 1<<16 + 1 // above the limit of cases of reflect.Select
+
+	semaphore := NewWeighted(leases, WithAutoRelease())
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 0; i < leases; i++ {
+		_, err := semaphore.Acquire(BreakByContext(context.WithCancel(ctx)))
+		if !assert.NoError(t, err) {
+			break
+		}
+	}
+	assert.Equal(t, uint32(leases), semaphore.Peek())
+
+	cancel()
+	for semaphore.Peek() != 0 {
+		runtime.Gosched()
+	}
+	semaphore.(*draft).lock()
+	assert.Equal(t, 0, semaphore.(*draft).leases.Len())
+	semaphore.(*draft).unlock()
+}
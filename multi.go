@@ -0,0 +1,79 @@
+package semaphore
+
+// AcquireAll occupies one place in each of the semaphores or none of them.
+// A semaphore given several times is occupied by as many places at once.
+// It waits for the places in one semaphore at a time and only tries
+// the others without waiting. If any of them has no place, everything
+// occupied is released and the waiting continues on that semaphore,
+// so concurrent calls with different order of semaphores do not deadlock.
+// The operation can be canceled using breaker. In this case,
+// it returns an appropriate error.
+func AcquireAll(breaker BreakCloser, semaphores ...Interface) (Releaser, error) {
+	if len(semaphores) == 0 {
+		return multiReleaser(nil), nil
+	}
+
+	claims := make([]claim, 0, len(semaphores))
+	index := make(map[Interface]int, len(semaphores))
+	for _, semaphore := range semaphores {
+		if i, is := index[semaphore]; is {
+			claims[i].places++
+			continue
+		}
+		index[semaphore] = len(claims)
+		claims = append(claims, claim{semaphore, 1})
+	}
+
+	first := 0
+	for {
+		releaser, err := claims[first].semaphore.Acquire(breaker, claims[first].places)
+		if err != nil {
+			return nil, err
+		}
+		releasers := make(multiReleaser, 0, len(claims))
+		releasers = append(releasers, releaser)
+
+		next := -1
+		for i, claim := range claims {
+			if i == first {
+				continue
+			}
+			releaser, err := claim.semaphore.Try(breaker, claim.places)
+			if err == nil {
+				releasers = append(releasers, releaser)
+				continue
+			}
+			_ = releasers.Release()
+			if !IsNoPlace(err) {
+				return nil, err
+			}
+			next = i
+			break
+		}
+		if next == -1 {
+			return releasers, nil
+		}
+		first = next
+	}
+}
+
+// claim is the number of places AcquireAll occupies in the semaphore.
+type claim struct {
+	semaphore Interface
+	places    uint32
+}
+
+type multiReleaser []Releaser
+
+func (releasers multiReleaser) Release() error {
+	if len(releasers) == 0 {
+		return errEmpty
+	}
+	var err error
+	for _, releaser := range releasers {
+		if e := releaser.Release(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireAll(t *testing.T) {
+	db, cpu := NewWeighted(1), NewWeighted(1)
+
+	wg := &sync.WaitGroup{}
+	for _, order := range [][]Interface{{db, cpu}, {cpu, db}} {
+		wg.Add(1)
+		go func(semaphores []Interface) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				releaser, err := AcquireAll(nil, semaphores...)
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, uint32(1), db.Peek())
+				assert.Equal(t, uint32(1), cpu.Peek())
+				assert.NoError(t, releaser.Release())
+			}
+		}(order)
+	}
+	wg.Wait()
+	assert.Equal(t, uint32(0), db.Peek())
+	assert.Equal(t, uint32(0), cpu.Peek())
+}
+
+func TestAcquireAll_Cancel(t *testing.T) {
+	db, cpu := NewWeighted(1), NewWeighted(1)
+	releaser, _ := cpu.Acquire(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := AcquireAll(&breaker{ctx}, db, cpu)
+		done <- err
+	}()
+	waitFor(cpu, 1)
+	assert.Equal(t, uint32(0), db.Peek(), "nothing must be held while waiting")
+	cancel()
+
+	assert.True(t, IsTimeout(<-done))
+	assert.Equal(t, uint32(0), db.Peek())
+	assert.NoError(t, releaser.Release())
+	assert.True(t, IsEmpty(multiReleaser(nil).Release()))
+}
+
+func TestAcquireAll_Duplicates(t *testing.T) {
+	db, cpu := NewWeighted(1), NewWeighted(2)
+
+	releaser, err := AcquireAll(nil, db, cpu, cpu)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), db.Peek())
+	assert.Equal(t, uint32(2), cpu.Peek())
+	assert.NoError(t, releaser.Release())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := AcquireAll(&breaker{ctx}, cpu, db, db)
+		done <- err
+	}()
+	waitFor(db, 1)
+	assert.Equal(t, uint32(0), cpu.Peek(), "nothing must be held while waiting")
+	cancel()
+
+	assert.True(t, IsTimeout(<-done))
+	assert.Equal(t, uint32(0), cpu.Peek())
+	assert.Equal(t, uint32(0), db.Peek())
+}
@@ -0,0 +1,122 @@
+package semaphore
+
+import "time"
+
+// An Option configures a semaphore during its construction.
+type Option func(*config)
+
+// A Clock provides the current time. By default, semaphores use
+// the system clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// A Timer is a Clock that also measures durations. By default,
+// the features that wait for a duration use the system timers.
+type Timer interface {
+	Clock
+	// After returns a channel that's closed when the duration elapses.
+	After(time.Duration) <-chan struct{}
+}
+
+// An Order defines the order in which waiters are served.
+type Order uint8
+
+const (
+	// FIFO serves the oldest waiter first. It is the default order.
+	FIFO Order = iota
+	// LIFO serves the newest waiter first.
+	LIFO
+	// AdaptiveLIFO serves waiters in FIFO order until the queue stays
+	// non-empty longer than a threshold and in LIFO order after that.
+	AdaptiveLIFO
+)
+
+// WithAdaptiveLIFO sets the AdaptiveLIFO order with the given threshold.
+func WithAdaptiveLIFO(threshold time.Duration) Option {
+	return func(cnf *config) {
+		cnf.order, cnf.threshold = AdaptiveLIFO, threshold
+	}
+}
+
+// WithAutoRelease ties the places occupied by Acquire to the lifetime
+// of its breaker: they are released when the breaker fires even if
+// the Releaser is not called, and the call of the Releaser closes
+// the breaker. The places are reclaimed shortly after the breaker fires
+// by a goroutine that watches it while the places are held.
+func WithAutoRelease() Option {
+	return func(cnf *config) {
+		cnf.autorelease = true
+	}
+}
+
+// WithClock sets the clock used by the features that depend on time:
+// the CoDel management, the adaptive LIFO order, the deadline-aware
+// admission and the holder statistics. It is useful in tests.
+func WithClock(clock Clock) Option {
+	return func(cnf *config) {
+		cnf.now = clock.Now
+	}
+}
+
+// WithCoDel enables the Controlled Delay management of the waiter queue.
+// If the minimum time that waiters spend in the queue exceeds the target
+// delay during the whole interval, the oldest waiters above the target
+// are shed with an error recognized by IsOverloaded until the queue drains.
+func WithCoDel(target, interval time.Duration) Option {
+	return func(cnf *config) {
+		cnf.codel.target, cnf.codel.interval = target, interval
+	}
+}
+
+// WithFlowWeight sets the weight of the flow with the key.
+// The flow receives free places in proportion to its weight
+// relative to the other flows with waiters.
+func WithFlowWeight(key string, weight uint32) Option {
+	return func(cnf *config) {
+		if cnf.weights == nil {
+			cnf.weights = make(map[string]uint32)
+		}
+		cnf.weights[key] = weight
+	}
+}
+
+// WithMaxWaiters limits the number of goroutines that can wait for a place
+// at the same time. When the queue is full, Acquire fails immediately
+// with an error recognized by IsQueueFull. Zero means no limit.
+func WithMaxWaiters(limit int) Option {
+	return func(cnf *config) {
+		cnf.waiters = limit
+	}
+}
+
+// WithOrder sets the order in which waiters are served.
+// The AdaptiveLIFO order set by it has zero threshold,
+// use WithAdaptiveLIFO to specify one.
+func WithOrder(order Order) Option {
+	return func(cnf *config) {
+		cnf.order = order
+	}
+}
+
+type config struct {
+	autorelease bool
+	codel       struct {
+		target   time.Duration
+		interval time.Duration
+	}
+	now       func() time.Time
+	order     Order
+	threshold time.Duration
+	waiters   int
+	weights   map[string]uint32
+}
+
+func configure(options []Option) config {
+	cnf := config{now: time.Now}
+	for _, option := range options {
+		option(&cnf)
+	}
+	return cnf
+}
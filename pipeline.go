@@ -0,0 +1,174 @@
+package semaphore
+
+import "sync"
+
+// Stage reads items from the input channel, runs f on them concurrently
+// while they fit the semaphore and writes the results to the returned channel
+// in the order of their completion. Every item occupies its places until its
+// result is received, so a slow reader slows down the stage.
+//
+// The returned channel is closed when the input channel is closed and all
+// items are processed. If the breaker fires, the stage stops reading the input
+// channel, drops the results not yet received and closes the returned channel
+// after the running calls of f return.
+func Stage[In, Out any](breaker Breaker, semaphore Interface, in <-chan In, f func(In) Out, options ...StageOption[In]) <-chan Out {
+	stage := newStage(breaker, semaphore, options)
+	out := make(chan Out)
+	go func() {
+		var wg sync.WaitGroup
+		defer close(out)
+		defer wg.Wait()
+		stage.dispatch(in, func(item In, releaser Releaser) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { _ = releaser.Release() }()
+				result := f(item)
+				select {
+				case out <- result:
+				case <-done(breaker):
+				}
+			}()
+		})
+	}()
+	return out
+}
+
+// OrderedStage is like Stage, but it writes the results to the returned channel
+// in the order of the items in the input channel. Every item occupies its places
+// until its result is received, including the time it waits for the results
+// of the preceding items.
+func OrderedStage[In, Out any](breaker Breaker, semaphore Interface, in <-chan In, f func(In) Out, options ...StageOption[In]) <-chan Out {
+	stage := newStage(breaker, semaphore, options)
+	out := make(chan Out)
+	pending := make(chan *ordered[Out], stage.backlog())
+	var wg sync.WaitGroup
+	go func() {
+		defer close(pending)
+		stage.dispatch(in, func(item In, releaser Releaser) {
+			result := &ordered[Out]{releaser: releaser, ready: make(chan struct{})}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result.value = f(item)
+				close(result.ready)
+			}()
+			pending <- result
+		})
+	}()
+	go func() {
+		defer close(out)
+		defer wg.Wait()
+		for result := range pending {
+			<-result.ready
+			select {
+			case out <- result.value:
+			case <-done(breaker):
+			}
+			_ = result.releaser.Release()
+		}
+	}()
+	return out
+}
+
+// StageOption configures a pipeline stage.
+type StageOption[In any] func(*stageConfig[In])
+
+// WithWeight sets the function that returns the number of places
+// occupied by an item. Heavier items take more of the capacity.
+// A zero weight is raised to one place, and a weight above the capacity
+// the semaphore has when the stage starts is reduced to it,
+// so such an item runs alone.
+func WithWeight[In any](weight func(In) uint32) StageOption[In] {
+	return func(cnf *stageConfig[In]) {
+		cnf.weight = weight
+	}
+}
+
+type stageConfig[In any] struct {
+	weight func(In) uint32
+}
+
+type stage[In any] struct {
+	breaker   Breaker
+	closer    BreakCloser
+	semaphore Interface
+	capacity  uint32
+	stageConfig[In]
+}
+
+func newStage[In any](breaker Breaker, semaphore Interface, options []StageOption[In]) *stage[In] {
+	stage := &stage[In]{breaker: breaker, semaphore: semaphore, capacity: semaphore.Size(0)}
+	for _, configure := range options {
+		configure(&stage.stageConfig)
+	}
+	if breaker != nil {
+		stage.closer = sharedBreaker{breaker}
+	}
+	return stage
+}
+
+// dispatch reads the items until the input channel is closed
+// or the breaker fires and passes them with their places to run.
+func (stage *stage[In]) dispatch(in <-chan In, run func(In, Releaser)) {
+	for {
+		var item In
+		select {
+		case received, ok := <-in:
+			if !ok {
+				return
+			}
+			item = received
+		case <-done(stage.breaker):
+			return
+		}
+		releaser, err := stage.semaphore.Acquire(stage.closer, stage.places(item))
+		if err != nil {
+			return
+		}
+		run(item, releaser)
+	}
+}
+
+// places returns the weight of the item limited by one and the capacity.
+func (stage *stage[In]) places(item In) uint32 {
+	if stage.weight == nil {
+		return 1
+	}
+	places := stage.weight(item)
+	if places == 0 {
+		return 1
+	}
+	if places > stage.capacity && stage.capacity > 0 {
+		return stage.capacity
+	}
+	return places
+}
+
+// backlog returns the number of items that can be in flight at once,
+// so the dispatcher is not blocked by the results waiting for their turn.
+func (stage *stage[In]) backlog() int {
+	const limit = 1024
+	if stage.capacity < limit {
+		return int(stage.capacity)
+	}
+	return limit
+}
+
+type ordered[Out any] struct {
+	releaser Releaser
+	ready    chan struct{}
+	value    Out
+}
+
+// sharedBreaker is the breaker of a stage passed to every Acquire,
+// so its Close does nothing instead of firing the whole stage.
+type sharedBreaker struct {
+	Breaker
+}
+
+func (sharedBreaker) Close() {}
+
+func (breaker sharedBreaker) Unwrap() Breaker {
+	return breaker.Breaker
+}
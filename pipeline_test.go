@@ -0,0 +1,149 @@
+package semaphore
+
+import (
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func generate(n int) <-chan int {
+	ch := make(chan int)
+	go func() {
+		defer close(ch)
+		for i := 0; i < n; i++ {
+			ch <- i
+		}
+	}()
+	return ch
+}
+
+func collect(ch <-chan int) []int {
+	var result []int
+	for item := range ch {
+		result = append(result, item)
+	}
+	return result
+}
+
+func TestStage(t *testing.T) {
+	semaphore, gate := NewWeighted(3), make(chan struct{})
+	var started int32
+	square := func(item int) int {
+		atomic.AddInt32(&started, 1)
+		<-gate
+		return item * item
+	}
+
+	out := Stage(nil, semaphore, generate(32), square)
+	waitFor(semaphore, 1)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&started), "the items must not exceed the capacity")
+	close(gate)
+	result := collect(out)
+	sort.Ints(result)
+	assert.Len(t, result, 32)
+	for i, item := range result {
+		assert.Equal(t, i*i, item)
+	}
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestStage_Weight(t *testing.T) {
+	for name, test := range map[string]struct {
+		weight  uint32
+		started int32
+	}{
+		"zero":  {0, 4},
+		"light": {2, 2},
+		"heavy": {8, 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			semaphore, gate := NewWeighted(4), make(chan struct{})
+			var started int32
+			block := func(item int) int {
+				atomic.AddInt32(&started, 1)
+				<-gate
+				return item
+			}
+			weight := WithWeight(func(int) uint32 { return test.weight })
+
+			out := Stage(nil, semaphore, generate(8), block, weight)
+			waitFor(semaphore, 1)
+			assert.Equal(t, test.started, atomic.LoadInt32(&started))
+			assert.Equal(t, uint32(4), semaphore.Peek())
+			close(gate)
+			assert.Len(t, collect(out), 8)
+			assert.Equal(t, uint32(0), semaphore.Peek())
+		})
+	}
+}
+
+func TestOrderedStage(t *testing.T) {
+	semaphore := NewWeighted(8)
+	var gates [8]chan struct{}
+	for i := range gates {
+		gates[i] = make(chan struct{})
+	}
+	var completed int32
+	shuffle := func(item int) int {
+		if item < len(gates) {
+			<-gates[item]
+		}
+		atomic.AddInt32(&completed, 1)
+		return item
+	}
+
+	out := OrderedStage(nil, semaphore, generate(32), shuffle)
+	waitFor(semaphore, 1)
+	for i := len(gates) - 1; i >= 0; i-- {
+		close(gates[i])
+		for atomic.LoadInt32(&completed) != int32(len(gates)-i) {
+			runtime.Gosched()
+		}
+	}
+	result := collect(out)
+	assert.Len(t, result, 32)
+	assert.True(t, sort.IntsAreSorted(result))
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestStage_Breaker(t *testing.T) {
+	for name, stage := range map[string]func(Breaker, Interface, <-chan int, func(int) int, ...StageOption[int]) <-chan int{
+		"unordered": Stage[int, int],
+		"ordered":   OrderedStage[int, int],
+	} {
+		t.Run(name, func(t *testing.T) {
+			breaker, semaphore := newCloser(), NewWeighted(2)
+			in, started, gate := make(chan int), make(chan struct{}), make(chan struct{})
+			out := stage(breaker, semaphore, in, func(item int) int {
+				if item == 2 {
+					close(started)
+					<-gate
+				}
+				return item
+			})
+
+			in <- 1
+			assert.Equal(t, 1, <-out)
+			in <- 2
+			<-started
+			breaker.Close()
+			select {
+			case <-out:
+				t.Fatal("the stage must wait for the running calls")
+			default:
+			}
+			close(gate)
+			for range out {
+			}
+			assert.Equal(t, uint32(0), semaphore.Peek())
+			select {
+			case in <- 3:
+				t.Fatal("the stage must stop reading the input channel")
+			default:
+			}
+		})
+	}
+}
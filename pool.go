@@ -0,0 +1,276 @@
+package semaphore
+
+import (
+	"sync"
+	"time"
+)
+
+// NewPool constructs a new thread-safe pool of objects gated by a semaphore
+// with the given capacity. The objects are created by the factory on demand,
+// so the pool holds at most capacity of them.
+func NewPool[T any](capacity uint32, factory func() (T, error), options ...PoolOption[T]) Pool[T] {
+	var cnf poolConfig[T]
+	for _, configure := range options {
+		configure(&cnf)
+	}
+	semaphore := newDraft(capacity, configure(cnf.options))
+	return &pool[T]{semaphore: semaphore, factory: factory, now: semaphore.now, poolConfig: cnf}
+}
+
+// Pool defines the functionality of a pool of objects
+// which number is limited by a semaphore.
+type Pool[T any] interface {
+	// Acquire checks out an idle object or creates a new one. The operation
+	// can be canceled using breaker. In this case, it returns an appropriate error.
+	// The Releaser returns the object to the pool and implements Discarder.
+	Acquire(BreakCloser) (T, Releaser, error)
+	// Try checks out an idle object or creates a new one without waiting.
+	Try(Breaker) (T, Releaser, error)
+
+	Stats() PoolStats
+
+	// Close fails all current and future calls of Acquire and Try
+	// with an appropriate error and destroys the idle objects.
+	// The objects checked out are destroyed when they are returned.
+	Close() error
+}
+
+// A Discarder is a Releaser that can destroy the object it holds
+// instead of returning it to the pool, e.g., if the object is broken.
+type Discarder interface {
+	Releaser
+	// Discard destroys the object and releases its place.
+	Discard() error
+}
+
+// PoolStats represents a snapshot of a pool state.
+type PoolStats struct {
+	// Stats is a snapshot of the semaphore state,
+	// where occupied places are objects checked out.
+	Stats
+	// Idle is a current number of idle objects.
+	Idle uint32
+	// Created is a total number of objects created by the factory.
+	Created uint64
+	// Destroyed is a total number of objects destroyed by the pool.
+	Destroyed uint64
+}
+
+// PoolOption configures a pool of objects.
+type PoolOption[T any] func(*poolConfig[T])
+
+// WithHealthCheck sets the function that checks an object on checkout
+// and on return. The object that fails the check is destroyed.
+func WithHealthCheck[T any](check func(T) error) PoolOption[T] {
+	return func(cnf *poolConfig[T]) {
+		cnf.check = check
+	}
+}
+
+// WithDestroy sets the function that destroys an object,
+// e.g., closes a connection.
+func WithDestroy[T any](destroy func(T)) PoolOption[T] {
+	return func(cnf *poolConfig[T]) {
+		cnf.destroy = destroy
+	}
+}
+
+// WithIdleTimeout sets the time after which an idle object is destroyed.
+// The idle objects are evicted by the next operation with the pool.
+func WithIdleTimeout[T any](timeout time.Duration) PoolOption[T] {
+	return func(cnf *poolConfig[T]) {
+		cnf.timeout = timeout
+	}
+}
+
+// WithSemaphoreOptions sets the options of the semaphore that gates the pool,
+// e.g., its order, limit of waiters or clock.
+func WithSemaphoreOptions[T any](options ...Option) PoolOption[T] {
+	return func(cnf *poolConfig[T]) {
+		cnf.options = append(cnf.options, options...)
+	}
+}
+
+type poolConfig[T any] struct {
+	check   func(T) error
+	destroy func(T)
+	timeout time.Duration
+	options []Option
+}
+
+type pool[T any] struct {
+	semaphore *draft
+	factory   func() (T, error)
+	now       func() time.Time
+
+	mu        sync.Mutex
+	closed    bool
+	idle      []idleObject[T]
+	created   uint64
+	destroyed uint64
+	poolConfig[T]
+}
+
+// idleObject is an object returned to the pool at the time.
+type idleObject[T any] struct {
+	object T
+	since  time.Time
+}
+
+func (pool *pool[T]) Acquire(breaker BreakCloser) (T, Releaser, error) {
+	releaser, err := pool.semaphore.Acquire(breaker, 1)
+	if err != nil {
+		var zero T
+		return zero, nil, err
+	}
+	return pool.checkout(releaser)
+}
+
+func (pool *pool[T]) Try(breaker Breaker) (T, Releaser, error) {
+	releaser, err := pool.semaphore.Try(breaker, 1)
+	if err != nil {
+		var zero T
+		return zero, nil, err
+	}
+	return pool.checkout(releaser)
+}
+
+func (pool *pool[T]) Stats() PoolStats {
+	stats := pool.semaphore.Stats()
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return PoolStats{Stats: stats, Idle: uint32(len(pool.idle)), Created: pool.created, Destroyed: pool.destroyed}
+}
+
+func (pool *pool[T]) Close() error {
+	if err := pool.semaphore.Close(); err != nil {
+		return err
+	}
+	pool.mu.Lock()
+	pool.closed = true
+	dead := pool.idle
+	pool.idle = nil
+	pool.mu.Unlock()
+	for _, idle := range dead {
+		pool.discard(idle.object)
+	}
+	return nil
+}
+
+// checkout takes the most recently returned healthy object or creates
+// a new one for the occupied place. It frees the place on failure.
+func (pool *pool[T]) checkout(releaser Releaser) (T, Releaser, error) {
+	for {
+		object, found := pool.pop()
+		if !found {
+			break
+		}
+		if pool.check == nil || pool.check(object) == nil {
+			return object, &pooled[T]{pool: pool, object: object, releaser: releaser}, nil
+		}
+		pool.discard(object)
+	}
+
+	object, err := pool.factory()
+	if err != nil {
+		_ = releaser.Release()
+		var zero T
+		return zero, nil, err
+	}
+	pool.mu.Lock()
+	pool.created++
+	pool.mu.Unlock()
+	return object, &pooled[T]{pool: pool, object: object, releaser: releaser}, nil
+}
+
+// pop evicts the expired idle objects and takes the most recent one.
+func (pool *pool[T]) pop() (T, bool) {
+	pool.mu.Lock()
+	dead := pool.evict()
+	var (
+		object T
+		found  bool
+	)
+	if last := len(pool.idle) - 1; last >= 0 {
+		object, found = pool.idle[last].object, true
+		pool.idle[last] = idleObject[T]{}
+		pool.idle = pool.idle[:last]
+	}
+	pool.mu.Unlock()
+	for _, idle := range dead {
+		pool.discard(idle.object)
+	}
+	return object, found
+}
+
+// push returns the healthy object to the idle ones.
+func (pool *pool[T]) push(object T) {
+	if pool.check != nil && pool.check(object) != nil {
+		pool.discard(object)
+		return
+	}
+	pool.mu.Lock()
+	if pool.closed {
+		pool.mu.Unlock()
+		pool.discard(object)
+		return
+	}
+	pool.idle = append(pool.idle, idleObject[T]{object: object, since: pool.now()})
+	dead := pool.evict()
+	pool.mu.Unlock()
+	for _, idle := range dead {
+		pool.discard(idle.object)
+	}
+}
+
+// evict removes the idle objects that are expired and returns them.
+// The oldest objects are at the beginning. It must be called under the lock.
+func (pool *pool[T]) evict() []idleObject[T] {
+	if pool.timeout <= 0 {
+		return nil
+	}
+	deadline, expired := pool.now().Add(-pool.timeout), 0
+	for expired < len(pool.idle) && !pool.idle[expired].since.After(deadline) {
+		expired++
+	}
+	if expired == 0 {
+		return nil
+	}
+	dead := append([]idleObject[T](nil), pool.idle[:expired]...)
+	pool.idle = append(pool.idle[:0], pool.idle[expired:]...)
+	return dead
+}
+
+func (pool *pool[T]) discard(object T) {
+	if pool.destroy != nil {
+		pool.destroy(object)
+	}
+	pool.mu.Lock()
+	pool.destroyed++
+	pool.mu.Unlock()
+}
+
+type pooled[T any] struct {
+	pool     *pool[T]
+	object   T
+	releaser Releaser
+	once     sync.Once
+}
+
+func (pooled *pooled[T]) Release() error {
+	return pooled.finish(pooled.pool.push)
+}
+
+func (pooled *pooled[T]) Discard() error {
+	return pooled.finish(pooled.pool.discard)
+}
+
+// finish returns or destroys the object once and frees its place.
+func (pooled *pooled[T]) finish(action func(T)) error {
+	err := errEmpty
+	pooled.once.Do(func() {
+		action(pooled.object)
+		err = pooled.releaser.Release()
+	})
+	return err
+}
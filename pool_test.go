@@ -0,0 +1,141 @@
+package semaphore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type connection struct {
+	id     int
+	broken bool
+	closed bool
+}
+
+func factoryOf(created *[]*connection) func() (*connection, error) {
+	return func() (*connection, error) {
+		conn := &connection{id: len(*created) + 1}
+		*created = append(*created, conn)
+		return conn, nil
+	}
+}
+
+func TestPool(t *testing.T) {
+	var created []*connection
+	pool := NewPool(2, factoryOf(&created))
+
+	first, releaser, err := pool.Acquire(nil)
+	assert.NoError(t, err)
+	second, other, err := pool.Try(nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.id, second.id)
+	_, _, err = pool.Try(nil)
+	assert.True(t, IsNoPlace(err))
+
+	assert.NoError(t, releaser.Release())
+	assert.True(t, IsEmpty(releaser.Release()))
+	reused, releaser, err := pool.Acquire(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, first, reused)
+	assert.Len(t, created, 2)
+
+	assert.NoError(t, releaser.Release())
+	assert.NoError(t, other.Release())
+	stats := pool.Stats()
+	assert.Equal(t, uint32(2), stats.Idle)
+	assert.Equal(t, uint32(0), stats.Occupied)
+	assert.Equal(t, uint64(2), stats.Created)
+}
+
+func TestPool_HealthCheck(t *testing.T) {
+	var created []*connection
+	pool := NewPool(1, factoryOf(&created),
+		WithHealthCheck(func(conn *connection) error {
+			if conn.broken {
+				return errors.New("broken")
+			}
+			return nil
+		}),
+		WithDestroy(func(conn *connection) { conn.closed = true }),
+	)
+
+	conn, releaser, _ := pool.Acquire(nil)
+	conn.broken = true
+	assert.NoError(t, releaser.Release())
+	assert.True(t, conn.closed)
+	assert.Equal(t, uint32(0), pool.Stats().Idle)
+
+	conn, releaser, _ = pool.Acquire(nil)
+	assert.NoError(t, releaser.Release())
+	conn.broken = true
+	fresh, releaser, _ := pool.Acquire(nil)
+	assert.True(t, conn.closed)
+	assert.NotEqual(t, conn, fresh)
+
+	assert.NoError(t, releaser.(Discarder).Discard())
+	assert.True(t, fresh.closed)
+	assert.True(t, IsEmpty(releaser.Release()))
+	stats := pool.Stats()
+	assert.Equal(t, uint64(3), stats.Created)
+	assert.Equal(t, uint64(3), stats.Destroyed)
+	assert.Equal(t, uint32(0), stats.Occupied)
+}
+
+func TestPool_IdleTimeout(t *testing.T) {
+	var (
+		created     []*connection
+		nanoseconds int64
+	)
+	pool := NewPool(2, factoryOf(&created),
+		WithIdleTimeout[*connection](time.Minute),
+		WithDestroy(func(conn *connection) { conn.closed = true }),
+		WithSemaphoreOptions[*connection](withClock(&nanoseconds)),
+	)
+
+	old, first, _ := pool.Acquire(nil)
+	recent, second, _ := pool.Acquire(nil)
+	assert.NoError(t, first.Release())
+	nanoseconds += int64(time.Minute / 2)
+	assert.NoError(t, second.Release())
+	nanoseconds += int64(time.Minute / 2)
+
+	conn, releaser, _ := pool.Acquire(nil)
+	assert.True(t, old.closed)
+	assert.Equal(t, recent, conn)
+	assert.NoError(t, releaser.Release())
+	assert.Equal(t, uint32(1), pool.Stats().Idle)
+}
+
+func TestPool_Factory(t *testing.T) {
+	failure := errors.New("connection refused")
+	pool := NewPool(1, func() (*connection, error) { return nil, failure })
+
+	_, releaser, err := pool.Acquire(nil)
+	assert.Equal(t, failure, err)
+	assert.Nil(t, releaser)
+	assert.Equal(t, uint32(0), pool.Stats().Occupied)
+}
+
+func TestPool_Close(t *testing.T) {
+	var created []*connection
+	pool := NewPool(2, factoryOf(&created), WithDestroy(func(conn *connection) { conn.closed = true }))
+
+	idle, releaser, _ := pool.Acquire(nil)
+	assert.NoError(t, releaser.Release())
+	busy, releaser, _ := pool.Acquire(nil)
+	assert.Equal(t, idle, busy)
+	other, second, _ := pool.Acquire(nil)
+	assert.NoError(t, second.Release())
+
+	assert.NoError(t, pool.Close())
+	assert.True(t, IsClosed(pool.Close()))
+	assert.True(t, other.closed)
+	_, _, err := pool.Acquire(nil)
+	assert.True(t, IsClosed(err))
+
+	assert.NoError(t, releaser.Release())
+	assert.True(t, busy.closed)
+	assert.Equal(t, uint32(0), pool.Stats().Idle)
+}
@@ -0,0 +1,58 @@
+package semaphore
+
+// NewRW constructs a new thread-safe reader/writer semaphore
+// that admits up to capacity shared holders or one exclusive holder.
+//
+// Waiters are served in the order of their arrival, so as in sync.RWMutex
+// a waiting exclusive acquisition blocks the new shared ones
+// and readers cannot starve writers.
+func NewRW(capacity uint32) RW {
+	return &rw{semaphore: NewWeighted(capacity), capacity: capacity}
+}
+
+// RW defines the functionality of the Semaphore pattern
+// with shared and exclusive acquisition.
+type RW interface {
+	// Shared occupies one place. The operation can be canceled using breaker.
+	// In this case, it returns an appropriate error.
+	Shared(BreakCloser) (Releaser, error)
+	// TryShared tries to occupy one place without waiting.
+	TryShared(Breaker) (Releaser, error)
+	// Exclusive occupies the whole capacity. The operation can be canceled
+	// using breaker. In this case, it returns an appropriate error.
+	Exclusive(BreakCloser) (Releaser, error)
+	// TryExclusive tries to occupy the whole capacity without waiting.
+	TryExclusive(Breaker) (Releaser, error)
+
+	Peek() uint32
+	Stats() Stats
+}
+
+type rw struct {
+	semaphore Interface
+	capacity  uint32
+}
+
+func (semaphore *rw) Shared(breaker BreakCloser) (Releaser, error) {
+	return semaphore.semaphore.Acquire(breaker, 1)
+}
+
+func (semaphore *rw) TryShared(breaker Breaker) (Releaser, error) {
+	return semaphore.semaphore.Try(breaker, 1)
+}
+
+func (semaphore *rw) Exclusive(breaker BreakCloser) (Releaser, error) {
+	return semaphore.semaphore.Acquire(breaker, semaphore.capacity)
+}
+
+func (semaphore *rw) TryExclusive(breaker Breaker) (Releaser, error) {
+	return semaphore.semaphore.Try(breaker, semaphore.capacity)
+}
+
+func (semaphore *rw) Peek() uint32 {
+	return semaphore.semaphore.Peek()
+}
+
+func (semaphore *rw) Stats() Stats {
+	return semaphore.semaphore.Stats()
+}
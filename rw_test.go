@@ -0,0 +1,42 @@
+package semaphore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRW(t *testing.T) {
+	semaphore := NewRW(3)
+
+	r1, err := semaphore.Shared(nil)
+	assert.NoError(t, err)
+	r2, err := semaphore.TryShared(nil)
+	assert.NoError(t, err)
+	_, err = semaphore.TryExclusive(nil)
+	assert.True(t, IsNoPlace(err))
+
+	writer := make(chan Releaser)
+	go func() {
+		releaser, _ := semaphore.Exclusive(nil)
+		writer <- releaser
+	}()
+	waitFor(semaphore, 1)
+
+	_, err = semaphore.TryShared(nil)
+	assert.True(t, IsNoPlace(err), "a waiting writer must block new readers")
+	reader := make(chan Releaser)
+	go func() {
+		releaser, _ := semaphore.Shared(nil)
+		reader <- releaser
+	}()
+	waitFor(semaphore, 2)
+
+	assert.NoError(t, r1.Release())
+	assert.NoError(t, r2.Release())
+	w := <-writer
+	assert.Equal(t, uint32(3), semaphore.Peek())
+	assert.NoError(t, w.Release())
+	assert.NoError(t, (<-reader).Release())
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
@@ -1,8 +1,13 @@
 // Package semaphore provides an implementation of Semaphore pattern
-// with timeout of lock/unlock operations based on channels.
+// with timeout of lock/unlock operations.
 package semaphore
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
 
 // ReleaseFunc tells a semaphore to release the previously occupied slot
 // and ignore an error if it occurs.
@@ -15,8 +20,35 @@ func (f ReleaseFunc) Release() error {
 }
 
 // New constructs a new thread-safe Semaphore with the given capacity.
-func New(capacity int) Semaphore {
-	return make(semaphore, capacity)
+// Uncontended slots are occupied and released without locking.
+func New(capacity int, options ...Option) Semaphore {
+	semaphore := &semaphore{draft: newDraft(uint32(capacity), configure(options))}
+	semaphore.release = func() { _ = semaphore.draft.Release() } //nolint: gas
+	return semaphore
+}
+
+// IsClosed checks if passed error is related to call Acquire on closed semaphore.
+func IsClosed(err error) bool {
+	return err == errClosed
+}
+
+// A DeadlineError is returned by Acquire if the estimated waiting time
+// exceeds the time remaining until the deadline of the breaker.
+type DeadlineError struct {
+	Estimated time.Duration
+	Available time.Duration
+}
+
+// Error implements the built-in error interface.
+func (err *DeadlineError) Error() string {
+	return fmt.Sprintf("estimated waiting time %s exceeds available %s", err.Estimated, err.Available)
+}
+
+// IsDeadline checks if passed error is related to call Acquire on full semaphore
+// when the waiter cannot be served before the deadline of the breaker.
+func IsDeadline(err error) bool {
+	_, is := err.(*DeadlineError)
+	return is
 }
 
 // IsEmpty checks if passed error is related to call Release on empty semaphore.
@@ -24,11 +56,77 @@ func IsEmpty(err error) bool {
 	return err == errEmpty
 }
 
+// IsInterrupted checks if passed error is related to an Interrupter
+// that is closed or fired by a channel or by a breaker without a reason.
+func IsInterrupted(err error) bool {
+	return err == errInterrupted
+}
+
 // IsNoPlace checks if passed error is related to call Catch on full semaphore.
 func IsNoPlace(err error) bool {
 	return err == errNoPlace
 }
 
+// IsOverloaded checks if passed error is related to shedding a waiter
+// from the overloaded queue.
+func IsOverloaded(err error) bool {
+	return err == errOverload
+}
+
+// A PanicError is returned by Do and its counterparts with WithRecovery
+// if the function panics and by the Future of a panicking task.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error implements the built-in error interface.
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", err.Value)
+}
+
+// IsPanic checks if passed error is related to a recovered panic.
+func IsPanic(err error) bool {
+	_, is := err.(*PanicError)
+	return is
+}
+
+// IsQueueFull checks if passed error is related to call Acquire on full semaphore
+// when the limit of waiters is reached.
+func IsQueueFull(err error) bool {
+	return err == errQueueFull
+}
+
+// IsRejected checks if passed error is related to a task dropped
+// by the rejection policy of an Executor.
+func IsRejected(err error) bool {
+	return err == errRejected
+}
+
+// IsShutdown checks if passed error is related to a task submitted
+// to or dropped by an Executor that is shut down.
+func IsShutdown(err error) bool {
+	return err == errShutdown
+}
+
+// A SignalError is the reason of an Interrupter
+// that fires by an operating system signal.
+type SignalError struct {
+	Signal os.Signal
+}
+
+// Error implements the built-in error interface.
+func (err *SignalError) Error() string {
+	return "interrupted by signal " + err.Signal.String()
+}
+
+// IsSignal checks if passed error is related to an Interrupter
+// that fires by an operating system signal.
+func IsSignal(err error) bool {
+	_, is := err.(*SignalError)
+	return is
+}
+
 // IsTimeout checks if passed error is related to call Acquire on full semaphore.
 func IsTimeout(err error) bool {
 	return err == errTimeout
@@ -37,55 +135,107 @@ func IsTimeout(err error) bool {
 var (
 	nothing ReleaseFunc = func() {}
 
-	errEmpty   = errors.New("semaphore is empty")
-	errNoPlace = errors.New("semaphore has no place")
-	errTimeout = errors.New("operation timeout")
+	errClosed      = errors.New("semaphore is closed")
+	errEmpty       = errors.New("semaphore is empty")
+	errInterrupted = errors.New("operation interrupted")
+	errNoPlace     = errors.New("semaphore has no place")
+	errOverload    = errors.New("semaphore is overloaded")
+	errQueueFull   = errors.New("semaphore queue is full")
+	errRejected    = errors.New("task is rejected")
+	errShutdown    = errors.New("executor is shut down")
+	errTimeout     = errors.New("operation timeout")
 )
 
-type semaphore chan struct{}
+// semaphore occupies slots by CAS while nobody waits for them
+// and falls back to the waiter queue of the draft otherwise.
+// Its slots are not bound to holders, so every call of the shared
+// release function frees one slot.
+type semaphore struct {
+	*draft
+	release ReleaseFunc
+}
 
-func (semaphore semaphore) Acquire(deadline <-chan struct{}) (ReleaseFunc, error) {
-	select {
-	case semaphore <- struct{}{}:
-		return func() { _ = semaphore.Release() }, nil //nolint: gas
-	case <-deadline:
-		return nothing, errTimeout
+func (semaphore *semaphore) Acquire(deadline <-chan struct{}) (ReleaseFunc, error) {
+	if semaphore.grab(1) {
+		return semaphore.release, nil
+	}
+	releaser, err := semaphore.acquire(chanBreaker(deadline), 1, 1)
+	if err != nil {
+		return nothing, err
 	}
+	semaphore.detach(releaser)
+	return semaphore.release, nil
 }
 
-func (semaphore semaphore) Catch() (ReleaseFunc, error) {
-	select {
-	case semaphore <- struct{}{}:
-		return func() { _ = semaphore.Release() }, nil //nolint: gas
-	default:
-		return nothing, errNoPlace
+func (semaphore *semaphore) Catch() (ReleaseFunc, error) {
+	if semaphore.grab(1) {
+		return semaphore.release, nil
 	}
+	result, err := semaphore.Try(nil, 1)
+	if err != nil {
+		return nothing, err
+	}
+	semaphore.detach(result.(*releaser))
+	return semaphore.release, nil
 }
 
-func (semaphore semaphore) Capacity() int {
-	return cap(semaphore)
+func (semaphore *semaphore) Capacity() int {
+	return int(semaphore.Size(0))
 }
 
-func (semaphore semaphore) Occupied() int {
-	return len(semaphore)
+func (semaphore *semaphore) Drain(deadline <-chan struct{}) (int, error) {
+	if _, err := semaphore.draft.Drain(chanBreaker(deadline)); err != nil {
+		return semaphore.Occupied(), err
+	}
+	return 0, nil
 }
 
-func (semaphore semaphore) Release() error {
-	select {
-	case <-semaphore:
-		return nil
-	default:
-		return errEmpty
-	}
+func (semaphore *semaphore) Occupied() int {
+	return int(semaphore.Peek())
+}
+
+func (semaphore *semaphore) Waiting() int {
+	semaphore.lock()
+	defer semaphore.unlock()
+	return semaphore.queue.Len()
 }
 
-func (semaphore semaphore) Signal(deadline <-chan struct{}) <-chan ReleaseFunc {
+func (semaphore *semaphore) Signal(deadline <-chan struct{}) <-chan ReleaseFunc {
+	var held *releaser
 	ch := make(chan ReleaseFunc, 1)
-	go func() {
-		if release, err := semaphore.Acquire(deadline); err == nil {
-			ch <- release
-		}
-		close(ch)
-	}()
+	semaphore.signal(chanBreaker(deadline), &signal{
+		deliver: func(releaser *releaser) {
+			if releaser != nil {
+				held = releaser
+				ch <- func() { _ = releaser.Release() }
+			}
+			close(ch)
+		},
+		undelivered: func() bool { return len(ch) > 0 },
+		reclaim: func() *releaser {
+			select {
+			case _, ok := <-ch:
+				if ok {
+					return held
+				}
+			default:
+			}
+			return nil
+		},
+	})
 	return ch
 }
+
+// detach removes the places from the active holders,
+// so they are freed by the shared release function.
+func (semaphore *semaphore) detach(releaser *releaser) {
+	semaphore.lock()
+	semaphore.forget(releaser)
+	semaphore.unlock()
+}
+
+type chanBreaker <-chan struct{}
+
+func (breaker chanBreaker) Done() <-chan struct{} {
+	return breaker
+}
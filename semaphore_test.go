@@ -2,6 +2,7 @@ package semaphore
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"runtime"
 	"sync"
@@ -114,3 +115,146 @@ func TestSemaphore_Concurrently(t *testing.T) {
 		t.Errorf("zero occupied places are expected but received %d instead", semaphore.Occupied())
 	}
 }
+
+func TestSemaphore_Acquire_QueueFull(t *testing.T) {
+	semaphore := New(1, WithMaxWaiters(1))
+	release, err := semaphore.Acquire(nil)
+	assert.NoError(t, err)
+
+	deadline := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := semaphore.Acquire(deadline)
+		done <- err
+	}()
+	for semaphore.Waiting() != 1 {
+		runtime.Gosched()
+	}
+
+	_, err = semaphore.Acquire(nil)
+	assert.True(t, IsQueueFull(err))
+	assert.Equal(t, 1, semaphore.Waiting())
+
+	close(deadline)
+	assert.True(t, IsTimeout(<-done))
+	assert.Equal(t, 0, semaphore.Waiting())
+	release()
+}
+
+func TestSemaphore_Close(t *testing.T) {
+	semaphore := New(1)
+	release, err := semaphore.Acquire(nil)
+	assert.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		_, err := semaphore.Acquire(nil)
+		done <- err
+	}()
+	for semaphore.Waiting() != 1 {
+		runtime.Gosched()
+	}
+
+	assert.NoError(t, semaphore.Close())
+	assert.True(t, IsClosed(semaphore.Close()))
+	assert.True(t, IsClosed(<-done))
+	_, err = semaphore.Catch()
+	assert.True(t, IsClosed(err))
+
+	deadline := make(chan struct{})
+	close(deadline)
+	active, err := semaphore.Drain(deadline)
+	assert.True(t, IsTimeout(err))
+	assert.Equal(t, 1, active)
+	assert.Equal(t, 1, semaphore.Occupied())
+
+	go release()
+	active, err = semaphore.Drain(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, active)
+	assert.Equal(t, 0, semaphore.Occupied())
+}
+
+func TestSemaphore_Allocations(t *testing.T) {
+	semaphore := New(1)
+	assert.Equal(t, float64(0), testing.AllocsPerRun(100, func() {
+		release, _ := semaphore.Acquire(nil)
+		release()
+	}))
+	assert.Equal(t, float64(0), testing.AllocsPerRun(100, func() {
+		release, _ := semaphore.Catch()
+		release()
+	}))
+}
+
+func TestSemaphore_Contended(t *testing.T) {
+	semaphore := New(1)
+	release, err := semaphore.Acquire(nil)
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		release, err := semaphore.Acquire(nil)
+		assert.NoError(t, err)
+		release()
+		close(done)
+	}()
+	for semaphore.Waiting() != 1 {
+		runtime.Gosched()
+	}
+	_, err = semaphore.Catch()
+	assert.True(t, IsNoPlace(err))
+
+	release()
+	<-done
+	assert.Equal(t, 0, semaphore.Occupied())
+	release, err = semaphore.Catch()
+	assert.NoError(t, err)
+	release()
+	assert.True(t, IsEmpty(semaphore.Release()))
+}
+
+type acquirer interface {
+	Acquire(deadline <-chan struct{}) (ReleaseFunc, error)
+}
+
+// chanSemaphore is the previous implementation based on a channel.
+type chanSemaphore chan struct{}
+
+func (semaphore chanSemaphore) Acquire(deadline <-chan struct{}) (ReleaseFunc, error) {
+	select {
+	case semaphore <- struct{}{}:
+		return func() { <-semaphore }, nil
+	case <-deadline:
+		return nothing, errTimeout
+	}
+}
+
+func BenchmarkSemaphore(b *testing.B) {
+	implementations := []struct {
+		name string
+		new  func(capacity int) acquirer
+	}{
+		{"chan", func(capacity int) acquirer { return make(chanSemaphore, capacity) }},
+		{"cas", func(capacity int) acquirer { return New(capacity) }},
+	}
+	for _, capacity := range []int{1, 64} {
+		for _, procs := range []int{1, 2, 4, 8, 16, 32, 64} {
+			for _, implementation := range implementations {
+				name := fmt.Sprintf("capacity=%d/procs=%d/%s", capacity, procs, implementation.name)
+				b.Run(name, func(b *testing.B) {
+					defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+					semaphore := implementation.new(capacity)
+					b.ReportAllocs()
+					b.ResetTimer()
+					b.RunParallel(func(pb *testing.PB) {
+						for pb.Next() {
+							release, _ := semaphore.Acquire(nil)
+							release()
+						}
+					})
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package semaphoretest
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NewBreaker returns a Breaker that fires only on command.
+func NewBreaker() *Breaker {
+	return &Breaker{done: make(chan struct{})}
+}
+
+// A Breaker implements semaphore.BreakCloser and fires on command.
+// If it has a deadline, the deadline-aware features
+// of semaphores take it into account.
+type Breaker struct {
+	once     sync.Once
+	done     chan struct{}
+	closed   int32
+	deadline time.Time
+}
+
+// Done returns a channel that's closed when the Breaker fires.
+func (breaker *Breaker) Done() <-chan struct{} {
+	return breaker.done
+}
+
+// Break fires the Breaker. It is safe to call it many times.
+func (breaker *Breaker) Break() {
+	breaker.once.Do(func() { close(breaker.done) })
+}
+
+// Close fires the Breaker and marks it as closed.
+func (breaker *Breaker) Close() {
+	atomic.StoreInt32(&breaker.closed, 1)
+	breaker.Break()
+}
+
+// IsClosed reports whether the Breaker was closed.
+func (breaker *Breaker) IsClosed() bool {
+	return atomic.LoadInt32(&breaker.closed) == 1
+}
+
+// Deadline returns the deadline of the Breaker if it has one.
+func (breaker *Breaker) Deadline() (time.Time, bool) {
+	return breaker.deadline, !breaker.deadline.IsZero()
+}
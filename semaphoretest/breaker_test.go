@@ -0,0 +1,22 @@
+package semaphoretest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	breaker := NewBreaker()
+	_, ok := breaker.Deadline()
+	assert.False(t, ok)
+	assert.False(t, fired(breaker))
+
+	breaker.Break()
+	breaker.Break()
+	assert.True(t, fired(breaker))
+	assert.False(t, breaker.IsClosed())
+
+	breaker.Close()
+	assert.True(t, breaker.IsClosed())
+}
@@ -0,0 +1,97 @@
+// Package semaphoretest provides utilities for deterministic testing
+// of the code that uses semaphores.
+package semaphoretest
+
+import (
+	"sync"
+	"time"
+)
+
+// NewClock returns a manual Clock that starts at the given time.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// A Clock is a manual clock that implements semaphore.Timer.
+// Its time changes only by calls of Advance and Set.
+type Clock struct {
+	mu       sync.Mutex
+	now      time.Time
+	breakers []*Breaker
+}
+
+// Now returns the current time of the clock.
+func (clock *Clock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+// Advance moves the clock forward by the duration
+// and fires the breakers which deadlines have come.
+func (clock *Clock) Advance(duration time.Duration) {
+	clock.mu.Lock()
+	clock.now = clock.now.Add(duration)
+	clock.mu.Unlock()
+	clock.fire()
+}
+
+// Set sets the current time of the clock
+// and fires the breakers which deadlines have come.
+func (clock *Clock) Set(now time.Time) {
+	clock.mu.Lock()
+	clock.now = now
+	clock.mu.Unlock()
+	clock.fire()
+}
+
+// BreakAt returns a Breaker with the deadline
+// that fires when the clock reaches it.
+func (clock *Clock) BreakAt(deadline time.Time) *Breaker {
+	breaker := NewBreaker()
+	breaker.deadline = deadline
+	clock.mu.Lock()
+	clock.breakers = append(clock.breakers, breaker)
+	clock.mu.Unlock()
+	clock.fire()
+	return breaker
+}
+
+// BreakAfter returns a Breaker with the deadline after the duration
+// that fires when the clock reaches it.
+func (clock *Clock) BreakAfter(duration time.Duration) *Breaker {
+	return clock.BreakAt(clock.Now().Add(duration))
+}
+
+// After returns a channel that's closed when the clock advances
+// by the duration. It makes the Clock a semaphore.Timer.
+func (clock *Clock) After(duration time.Duration) <-chan struct{} {
+	return clock.BreakAfter(duration).Done()
+}
+
+// Pending returns the number of breakers and channels
+// waiting for their deadlines.
+func (clock *Clock) Pending() int {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return len(clock.breakers)
+}
+
+func (clock *Clock) fire() {
+	clock.mu.Lock()
+	var due []*Breaker
+	pending := clock.breakers[:0]
+	for _, breaker := range clock.breakers {
+		if clock.now.Before(breaker.deadline) {
+			pending = append(pending, breaker)
+			continue
+		}
+		due = append(due, breaker)
+	}
+	clock.breakers = pending
+	clock.mu.Unlock()
+
+	for _, breaker := range due {
+		breaker.Break()
+	}
+}
@@ -0,0 +1,113 @@
+package semaphoretest
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kamilsk/semaphore/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), clock.Now())
+
+	clock.Set(start)
+	assert.Equal(t, start, clock.Now())
+}
+
+func TestClock_BreakAfter(t *testing.T) {
+	clock := NewClock(time.Unix(0, 0))
+	early, late := clock.BreakAfter(time.Second), clock.BreakAfter(time.Minute)
+
+	deadline, ok := early.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, time.Unix(1, 0), deadline)
+
+	clock.Advance(time.Second)
+	assert.True(t, fired(early))
+	assert.False(t, fired(late))
+
+	clock.Set(time.Unix(60, 0))
+	assert.True(t, fired(late))
+
+	assert.True(t, fired(clock.BreakAt(time.Unix(0, 0))))
+}
+
+func fired(breaker *Breaker) bool {
+	select {
+	case <-breaker.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestClock_After(t *testing.T) {
+	var timer semaphore.Timer = NewClock(time.Unix(0, 0))
+	clock := timer.(*Clock)
+	after := clock.After(time.Second)
+	assert.Equal(t, 1, clock.Pending())
+
+	clock.Advance(time.Millisecond)
+	select {
+	case <-after:
+		t.Fatal("unexpected expiration")
+	default:
+	}
+	clock.Advance(time.Second)
+	<-after
+	assert.Equal(t, 0, clock.Pending())
+}
+
+func TestClock_KeepAlive(t *testing.T) {
+	clock := NewClock(time.Unix(0, 0))
+	executor := semaphore.NewExecutor(
+		semaphore.WithWorkers(1, 3),
+		semaphore.WithQueueSize(0),
+		semaphore.WithKeepAlive(time.Second),
+		semaphore.WithExecutorTimer(clock),
+	)
+
+	gate, started := make(chan struct{}), make(chan struct{})
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, executor.Execute(nil, semaphore.TaskFunc(func() { started <- struct{}{}; <-gate })))
+		<-started
+	}
+	assert.Equal(t, uint32(3), executor.Stats().Workers)
+
+	close(gate)
+	for clock.Pending() != 2 {
+		runtime.Gosched()
+	}
+	clock.Advance(time.Second - time.Nanosecond)
+	assert.Equal(t, uint32(3), executor.Stats().Workers, "the workers must be kept alive")
+	clock.Advance(time.Nanosecond)
+	for executor.Stats().Workers != 1 {
+		runtime.Gosched()
+	}
+	assert.NoError(t, executor.Shutdown(nil))
+}
+
+func TestClock_MaxHold(t *testing.T) {
+	clock := NewClock(time.Unix(0, 0))
+	go func() {
+		for clock.Pending() != 1 {
+			runtime.Gosched()
+		}
+		clock.Advance(time.Second)
+	}()
+	err := semaphore.Run(semaphore.NewWeighted(1), nil, 1, func(ctx context.Context) error {
+		deadline, _ := ctx.Deadline()
+		assert.Equal(t, time.Unix(1, 0), deadline)
+		<-ctx.Done()
+		return ctx.Err()
+	}, semaphore.WithMaxHold(time.Second), semaphore.WithHoldTimer(clock))
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
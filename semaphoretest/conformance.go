@@ -0,0 +1,443 @@
+package semaphoretest
+
+import (
+	"testing"
+
+	"github.com/kamilsk/semaphore/v5"
+)
+
+// TestInterface checks that the implementation of semaphore.Interface
+// behaves as expected. The constructor must return a new empty semaphore
+// with the given capacity and the FIFO order. The capacity passed to it
+// is at least 2.
+//
+// It checks capacity limits, weighted accounting, errors of Try and Acquire,
+// closing, cancellation by breaker, Signal semantics, resizing, errors of Release,
+// and finally runs concurrent operations and checks their linearizability
+// against a sequential model.
+func TestInterface(t *testing.T, constructor func(capacity uint32) semaphore.Interface) {
+	shared := func(capacity uint32) core { return constructor(capacity) }
+	t.Run("capacity", func(t *testing.T) { testCapacity(t, shared) })
+	t.Run("weighted", func(t *testing.T) { testWeighted(t, shared) })
+	t.Run("try and acquire", func(t *testing.T) { testTryAndAcquire(t, shared) })
+	t.Run("close", func(t *testing.T) { testClose(t, constructor) })
+	t.Run("cancellation", func(t *testing.T) { testCancellation(t, shared) })
+	t.Run("signal", func(t *testing.T) { testSignal(t, constructor) })
+	t.Run("resize", func(t *testing.T) { testResize(t, constructor) })
+	t.Run("release", func(t *testing.T) { testRelease(t, constructor) })
+	t.Run("linearizability", func(t *testing.T) { testLinearizability(t, constructor) })
+}
+
+// TestSharded checks that the implementation of semaphore.Sharded
+// behaves as expected. The constructor must return a new empty semaphore
+// with the given capacity. The capacity passed to it is at least 2.
+//
+// It checks the part of TestInterface that does not depend on the order
+// of waiters and the methods missing in semaphore.Sharded: capacity limits,
+// weighted accounting, errors of Try and Acquire and cancellation by breaker.
+func TestSharded(t *testing.T, constructor func(capacity uint32) semaphore.Sharded) {
+	shared := func(capacity uint32) core { return constructor(capacity) }
+	t.Run("capacity", func(t *testing.T) { testCapacity(t, shared) })
+	t.Run("weighted", func(t *testing.T) { testWeighted(t, shared) })
+	t.Run("try and acquire", func(t *testing.T) { testTryAndAcquire(t, shared) })
+	t.Run("cancellation", func(t *testing.T) { testCancellation(t, shared) })
+}
+
+// core is the part of the semaphores checked by both TestInterface
+// and TestSharded.
+type core interface {
+	Acquire(semaphore.BreakCloser, ...uint32) (semaphore.Releaser, error)
+	Try(semaphore.Breaker, ...uint32) (semaphore.Releaser, error)
+	Peek() uint32
+	Stats() semaphore.Stats
+}
+
+func testCapacity(t *testing.T, constructor func(uint32) core) {
+	sem := constructor(3)
+	if sized, is := sem.(interface{ Size(uint32) uint32 }); is {
+		if capacity := sized.Size(0); capacity != 3 {
+			t.Fatalf("unexpected capacity. expected: 3; obtained: %d", capacity)
+		}
+	}
+	if capacity := sem.Stats().Capacity; capacity != 3 {
+		t.Errorf("unexpected capacity in stats. expected: 3; obtained: %d", capacity)
+	}
+
+	releasers := make([]semaphore.Releaser, 0, 3)
+	for i := 0; i < 3; i++ {
+		releaser, err := sem.Try(nil)
+		if err != nil {
+			t.Fatalf("unexpected error on place %d: %v", i+1, err)
+		}
+		releasers = append(releasers, releaser)
+	}
+	if occupied := sem.Peek(); occupied != 3 {
+		t.Errorf("unexpected occupied places. expected: 3; obtained: %d", occupied)
+	}
+	if _, err := sem.Try(nil); !semaphore.IsNoPlace(err) {
+		t.Errorf("unexpected error on full semaphore. expected: no place; obtained: %v", err)
+	}
+	if _, err := sem.Try(nil, 4); !semaphore.IsNoPlace(err) {
+		t.Errorf("unexpected error above capacity. expected: no place; obtained: %v", err)
+	}
+	for _, releaser := range releasers {
+		if err := releaser.Release(); err != nil {
+			t.Errorf("unexpected error on release: %v", err)
+		}
+	}
+	if occupied := sem.Peek(); occupied != 0 {
+		t.Errorf("unexpected occupied places. expected: 0; obtained: %d", occupied)
+	}
+}
+
+func testWeighted(t *testing.T, constructor func(uint32) core) {
+	sem := constructor(5)
+	first, err := sem.Try(nil, 2, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if occupied := sem.Peek(); occupied != 3 {
+		t.Errorf("places are not summed. expected: 3; obtained: %d", occupied)
+	}
+	second, err := sem.Acquire(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if occupied := sem.Peek(); occupied != 4 {
+		t.Errorf("no places means one place. expected: 4; obtained: %d", occupied)
+	}
+	if _, err := sem.Try(nil, 2); !semaphore.IsNoPlace(err) {
+		t.Errorf("unexpected error. expected: no place; obtained: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		releaser, err := sem.Acquire(nil, 3)
+		if err == nil {
+			err = releaser.Release()
+		}
+		done <- err
+	}()
+	WaitForWaiters(sem, 1)
+	if err := first.Release(); err != nil {
+		t.Errorf("unexpected error on release: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error of the waiter: %v", err)
+	}
+	if occupied := sem.Peek(); occupied != 1 {
+		t.Errorf("release frees all held places. expected: 1; obtained: %d", occupied)
+	}
+	if err := second.Release(); err != nil {
+		t.Errorf("unexpected error on release: %v", err)
+	}
+}
+
+func testTryAndAcquire(t *testing.T, constructor func(uint32) core) {
+	sem := constructor(2)
+	broken := NewBreaker()
+	broken.Break()
+	if _, err := sem.Try(broken); !semaphore.IsTimeout(err) {
+		t.Errorf("unexpected error of Try with fired breaker. expected: timeout; obtained: %v", err)
+	}
+
+	holder, err := sem.Try(nil, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := sem.Try(nil); !semaphore.IsNoPlace(err) {
+		t.Errorf("unexpected error of Try. expected: no place; obtained: %v", err)
+	}
+	if _, err := sem.Acquire(broken); !semaphore.IsTimeout(err) {
+		t.Errorf("unexpected error of Acquire. expected: timeout; obtained: %v", err)
+	}
+	if err := holder.Release(); err != nil {
+		t.Errorf("unexpected error on release: %v", err)
+	}
+}
+
+func testClose(t *testing.T, constructor func(uint32) semaphore.Interface) {
+	sem := constructor(2)
+	holder, err := sem.Try(nil, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sem.Close(); err != nil {
+		t.Fatalf("unexpected error on close: %v", err)
+	}
+	if _, err := sem.Try(nil); !semaphore.IsClosed(err) {
+		t.Errorf("unexpected error of Try on closed semaphore. expected: closed; obtained: %v", err)
+	}
+	if _, err := sem.Acquire(nil); !semaphore.IsClosed(err) {
+		t.Errorf("unexpected error of Acquire on closed semaphore. expected: closed; obtained: %v", err)
+	}
+	if err := holder.Release(); err != nil {
+		t.Errorf("places must be released after close: %v", err)
+	}
+}
+
+func testCancellation(t *testing.T, constructor func(uint32) core) {
+	const waiters = 4
+
+	sem := constructor(2)
+	holder, err := sem.Try(nil, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	breaker, done := NewBreaker(), make(chan error, waiters)
+	for i := 0; i < waiters; i++ {
+		go func(places uint32) {
+			_, err := sem.Acquire(breaker, places)
+			done <- err
+		}(uint32(i%2 + 1))
+	}
+	WaitForWaiters(sem, waiters)
+	breaker.Break()
+	for i := 0; i < waiters; i++ {
+		if err := <-done; !semaphore.IsTimeout(err) {
+			t.Errorf("unexpected error of canceled waiter. expected: timeout; obtained: %v", err)
+		}
+	}
+	if waiting := sem.Stats().Waiting; waiting != 0 {
+		t.Errorf("canceled waiters are still in the queue: %d", waiting)
+	}
+	if occupied := sem.Peek(); occupied != 2 {
+		t.Errorf("unexpected occupied places. expected: 2; obtained: %d", occupied)
+	}
+
+	if err := holder.Release(); err != nil {
+		t.Fatalf("unexpected error on release: %v", err)
+	}
+	if occupied := sem.Peek(); occupied != 0 {
+		t.Errorf("canceled waiters leak places: %d", occupied)
+	}
+	releaser, err := sem.Try(nil, 2)
+	if err != nil {
+		t.Fatalf("canceled waiters leak places: %v", err)
+	}
+	_ = releaser.Release()
+}
+
+func testSignal(t *testing.T, constructor func(uint32) semaphore.Interface) {
+	sem := constructor(2)
+
+	releaser, ok := <-sem.Signal(nil)
+	if !ok {
+		t.Fatal("free place is not signaled")
+	}
+	if occupied := sem.Peek(); occupied != 1 {
+		t.Errorf("unexpected occupied places. expected: 1; obtained: %d", occupied)
+	}
+	if err := releaser.Release(); err != nil {
+		t.Errorf("unexpected error on release: %v", err)
+	}
+
+	broken := NewBreaker()
+	broken.Break()
+	if _, ok := <-sem.Signal(broken); ok {
+		t.Error("place is signaled after the breaker fired")
+	}
+
+	holder, err := sem.Try(nil, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	served := sem.Signal(nil)
+	if err := holder.Release(); err != nil {
+		t.Fatalf("unexpected error on release: %v", err)
+	}
+	releaser, ok = <-served
+	if !ok {
+		t.Fatal("released place is not signaled")
+	}
+
+	holder, _ = sem.Try(nil)
+	breaker := NewBreaker()
+	rejected := sem.Signal(breaker)
+	breaker.Break()
+	// the rejection of the waiter frees no place
+	if _, err := sem.Try(nil); !semaphore.IsNoPlace(err) {
+		t.Errorf("unexpected error. expected: no place; obtained: %v", err)
+	}
+	if _, ok := <-rejected; ok {
+		t.Error("place is signaled after the breaker fired")
+	}
+
+	breaker = NewBreaker()
+	unclaimed := sem.Signal(breaker)
+	_ = releaser.Release()
+	breaker.Break()
+	// the undelivered place is reclaimed asynchronously
+	WaitForOccupied(sem, 1)
+	if releaser, err = sem.Try(nil); err != nil {
+		t.Errorf("undelivered place is not reclaimed: %v", err)
+	} else {
+		_ = releaser.Release()
+	}
+	if _, ok := <-unclaimed; ok {
+		t.Error("reclaimed place is still delivered")
+	}
+	_ = holder.Release()
+}
+
+func testResize(t *testing.T, constructor func(uint32) semaphore.Interface) {
+	sem := constructor(2)
+	holder, err := sem.Try(nil, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	done := make(chan semaphore.Releaser, 1)
+	go func() {
+		releaser, _ := sem.Acquire(nil, 2)
+		done <- releaser
+	}()
+	WaitForWaiters(sem, 1)
+	if previous := sem.Size(4); previous != 2 {
+		t.Errorf("unexpected previous capacity. expected: 2; obtained: %d", previous)
+	}
+	releaser := <-done
+	if occupied := sem.Peek(); occupied != 4 {
+		t.Errorf("growth does not serve waiters. expected: 4; obtained: %d", occupied)
+	}
+
+	if previous := sem.Size(1); previous != 4 {
+		t.Errorf("unexpected previous capacity. expected: 4; obtained: %d", previous)
+	}
+	_ = holder.Release()
+	if _, err := sem.Try(nil); !semaphore.IsNoPlace(err) {
+		t.Errorf("shrinkage is ignored. expected: no place; obtained: %v", err)
+	}
+	_ = releaser.Release()
+	if releaser, err = sem.Try(nil); err != nil {
+		t.Errorf("unexpected error after shrinkage: %v", err)
+	} else {
+		_ = releaser.Release()
+	}
+}
+
+func testRelease(t *testing.T, constructor func(uint32) semaphore.Interface) {
+	sem := constructor(2)
+	if err := sem.Release(); !semaphore.IsEmpty(err) {
+		t.Errorf("unexpected error on empty semaphore. expected: empty; obtained: %v", err)
+	}
+
+	releaser, err := sem.Try(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := releaser.Release(); err != nil {
+		t.Errorf("unexpected error on release: %v", err)
+	}
+	if err := releaser.Release(); !semaphore.IsEmpty(err) {
+		t.Errorf("unexpected error on second release. expected: empty; obtained: %v", err)
+	}
+
+	if _, err := sem.Try(nil, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sem.Release(); err != nil {
+		t.Errorf("unexpected error on release of the semaphore: %v", err)
+	}
+	if occupied := sem.Peek(); occupied != 1 {
+		t.Errorf("release of the semaphore frees one place. expected: 1; obtained: %d", occupied)
+	}
+}
+
+// TestSemaphore checks that the implementation of semaphore.Semaphore
+// behaves as expected. The constructor must return a new empty semaphore
+// with the given capacity. The capacity passed to it is at least 2.
+func TestSemaphore(t *testing.T, constructor func(capacity int) semaphore.Semaphore) {
+	t.Run("capacity", func(t *testing.T) {
+		sem := constructor(2)
+		if capacity := sem.Capacity(); capacity != 2 {
+			t.Fatalf("unexpected capacity. expected: 2; obtained: %d", capacity)
+		}
+		first, err := sem.Catch()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		second, err := sem.Acquire(nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if occupied := sem.Occupied(); occupied != 2 {
+			t.Errorf("unexpected occupied slots. expected: 2; obtained: %d", occupied)
+		}
+		if _, err := sem.Catch(); !semaphore.IsNoPlace(err) {
+			t.Errorf("unexpected error of Catch. expected: no place; obtained: %v", err)
+		}
+		first()
+		second()
+		if occupied := sem.Occupied(); occupied != 0 {
+			t.Errorf("unexpected occupied slots. expected: 0; obtained: %d", occupied)
+		}
+		if err := sem.Release(); !semaphore.IsEmpty(err) {
+			t.Errorf("unexpected error on empty semaphore. expected: empty; obtained: %v", err)
+		}
+	})
+	t.Run("cancellation", func(t *testing.T) {
+		const waiters = 4
+
+		sem := constructor(2)
+		first, _ := sem.Catch()
+		second, _ := sem.Catch()
+
+		breaker, done := NewBreaker(), make(chan error, waiters)
+		for i := 0; i < waiters; i++ {
+			go func() {
+				_, err := sem.Acquire(breaker.Done())
+				done <- err
+			}()
+		}
+		WaitForLegacyWaiters(sem, waiters)
+		breaker.Break()
+		for i := 0; i < waiters; i++ {
+			if err := <-done; !semaphore.IsTimeout(err) {
+				t.Errorf("unexpected error of canceled call. expected: timeout; obtained: %v", err)
+			}
+		}
+		first()
+		second()
+		if occupied := sem.Occupied(); occupied != 0 {
+			t.Errorf("canceled calls leak slots: %d", occupied)
+		}
+	})
+	t.Run("signal", func(t *testing.T) {
+		sem := constructor(1)
+		release, ok := <-sem.Signal(nil)
+		if !ok {
+			t.Fatal("free slot is not signaled")
+		}
+
+		// the semaphore is full, so the signal cannot be served before the deadline
+		broken := NewBreaker()
+		broken.Break()
+		if _, ok := <-sem.Signal(broken.Done()); ok {
+			t.Error("slot is signaled after the deadline")
+		}
+		release()
+		if occupied := sem.Occupied(); occupied != 0 {
+			t.Errorf("unexpected occupied slots. expected: 0; obtained: %d", occupied)
+		}
+	})
+	t.Run("close", func(t *testing.T) {
+		// the only slot is occupied, so the calls below cannot take a free one
+		sem := constructor(1)
+		release, _ := sem.Catch()
+		if err := sem.Close(); err != nil {
+			t.Fatalf("unexpected error on close: %v", err)
+		}
+		if _, err := sem.Acquire(nil); !semaphore.IsClosed(err) {
+			t.Errorf("unexpected error of Acquire. expected: closed; obtained: %v", err)
+		}
+		if _, err := sem.Catch(); !semaphore.IsClosed(err) {
+			t.Errorf("unexpected error of Catch. expected: closed; obtained: %v", err)
+		}
+		release()
+		if active, err := sem.Drain(nil); active != 0 || err != nil {
+			t.Errorf("unexpected result of Drain. expected: 0, nil; obtained: %d, %v", active, err)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package semaphoretest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kamilsk/semaphore/v5"
+)
+
+func TestInterface_Weighted(t *testing.T) {
+	TestInterface(t, func(capacity uint32) semaphore.Interface {
+		return semaphore.NewWeighted(capacity)
+	})
+}
+
+func TestInterface_Shared(t *testing.T) {
+	TestInterface(t, func(capacity uint32) semaphore.Interface {
+		return semaphore.NewWeighted(capacity, semaphore.WithAutoRelease(), semaphore.WithMaxWaiters(16))
+	})
+}
+
+func TestSharded_Shards(t *testing.T) {
+	for _, shards := range []int{1, 2, 4} {
+		t.Run(fmt.Sprintf("shards=%d", shards), func(t *testing.T) {
+			TestSharded(t, func(capacity uint32) semaphore.Sharded {
+				return semaphore.NewSharded(capacity, shards)
+			})
+		})
+	}
+}
+
+func TestSemaphore_New(t *testing.T) {
+	TestSemaphore(t, func(capacity int) semaphore.Semaphore {
+		return semaphore.New(capacity)
+	})
+}
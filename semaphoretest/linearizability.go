@@ -0,0 +1,223 @@
+package semaphoretest
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/kamilsk/semaphore/v5"
+)
+
+// An Operation is a completed call of a semaphore method
+// recorded in a concurrent history.
+type Operation struct {
+	// Kind is a kind of the call.
+	Kind Kind
+	// Places is a number of places the call occupies, frees or observes.
+	Places uint32
+	// Ok is false if Try failed with no place.
+	Ok bool
+	// Call and Return are logical timestamps of the invocation
+	// and the response. Every timestamp of a history is unique.
+	Call, Return uint64
+}
+
+// String returns a human-readable representation of the Operation.
+func (op Operation) String() string {
+	return fmt.Sprintf("%s(%d)=%t@[%d,%d]", op.Kind, op.Places, op.Ok, op.Call, op.Return)
+}
+
+// Kind is a kind of a recorded call.
+type Kind uint8
+
+// The kinds of calls that the sequential model supports.
+const (
+	// OpAcquire occupies the places, waiting for them if necessary.
+	OpAcquire Kind = iota
+	// OpTry occupies the places if they are free and fails otherwise.
+	OpTry
+	// OpRelease frees the places.
+	OpRelease
+	// OpPeek observes the number of occupied places.
+	OpPeek
+)
+
+// String returns a name of the Kind.
+func (kind Kind) String() string {
+	switch kind {
+	case OpAcquire:
+		return "Acquire"
+	case OpTry:
+		return "Try"
+	case OpRelease:
+		return "Release"
+	case OpPeek:
+		return "Peek"
+	}
+	return "Unknown"
+}
+
+// Linearizable reports whether the concurrent history of operations
+// can be reordered into a sequential one that respects their real-time order
+// and is valid for the semaphore with the given capacity, which starts empty.
+// In the sequential model, Acquire and successful Try occupy free places,
+// failed Try finds not enough free places, Release frees places,
+// and Peek returns the number of occupied places.
+//
+// The history must contain at most 64 operations.
+func Linearizable(capacity uint32, history []Operation) bool {
+	if len(history) > 64 {
+		panic("semaphoretest: history is too long")
+	}
+	checker := linearizer{
+		capacity: capacity,
+		history:  history,
+		visited:  make(map[configuration]struct{}),
+	}
+	return checker.search(0, 0)
+}
+
+type configuration struct {
+	linearized uint64
+	occupied   uint32
+}
+
+type linearizer struct {
+	capacity uint32
+	history  []Operation
+	visited  map[configuration]struct{}
+}
+
+// search tries to extend the linearized prefix by each operation
+// that is minimal in the real-time order of the rest.
+func (checker *linearizer) search(linearized uint64, occupied uint32) bool {
+	if linearized == 1<<uint(len(checker.history))-1 {
+		return true
+	}
+	current := configuration{linearized, occupied}
+	if _, is := checker.visited[current]; is {
+		return false
+	}
+	checker.visited[current] = struct{}{}
+
+	horizon := ^uint64(0)
+	for i, op := range checker.history {
+		if linearized&(1<<uint(i)) == 0 && op.Return < horizon {
+			horizon = op.Return
+		}
+	}
+	for i, op := range checker.history {
+		if linearized&(1<<uint(i)) != 0 || op.Call > horizon {
+			continue
+		}
+		if next, valid := checker.apply(op, occupied); valid && checker.search(linearized|1<<uint(i), next) {
+			return true
+		}
+	}
+	return false
+}
+
+func (checker *linearizer) apply(op Operation, occupied uint32) (uint32, bool) {
+	fits := uint64(occupied)+uint64(op.Places) <= uint64(checker.capacity)
+	switch op.Kind {
+	case OpAcquire:
+		return occupied + op.Places, fits
+	case OpTry:
+		if op.Ok {
+			return occupied + op.Places, fits
+		}
+		return occupied, !fits
+	case OpRelease:
+		return occupied - op.Places, op.Places <= occupied
+	case OpPeek:
+		return occupied, op.Places == occupied
+	}
+	return occupied, false
+}
+
+func testLinearizability(t *testing.T, constructor func(uint32) semaphore.Interface) {
+	const rounds, capacity = 50, 3
+
+	for round := 0; round < rounds; round++ {
+		history, err := record(constructor(capacity), int64(round))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !Linearizable(capacity, history) {
+			t.Fatalf("history is not linearizable: %v", history)
+		}
+	}
+}
+
+// record runs random operations concurrently and returns their history.
+// Every goroutine holds at most one Releaser at a time and releases it
+// before the next acquisition, so Acquire always succeeds eventually.
+// All acquisitions by Acquire occupy one place, thus the FIFO queue
+// is not empty only if the semaphore is full.
+func record(sem semaphore.Interface, seed int64) ([]Operation, error) {
+	const goroutines, steps = 4, 4
+
+	var (
+		clock   uint64
+		mu      sync.Mutex
+		history []Operation
+		failure error
+		wg      sync.WaitGroup
+	)
+	tick := func() uint64 { return atomic.AddUint64(&clock, 1) }
+	commit := func(op Operation, err error) {
+		mu.Lock()
+		if err != nil && failure == nil {
+			failure = err
+		}
+		history = append(history, op)
+		mu.Unlock()
+	}
+
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(random *rand.Rand) {
+			defer wg.Done()
+			for step := 0; step < steps; step++ {
+				switch random.Intn(3) {
+				case 0:
+					op := Operation{Kind: OpAcquire, Places: 1, Ok: true, Call: tick()}
+					releaser, err := sem.Acquire(nil, op.Places)
+					op.Return = tick()
+					commit(op, err)
+					if err == nil {
+						release(releaser, op.Places, tick, commit)
+					}
+				case 1:
+					op := Operation{Kind: OpTry, Places: uint32(random.Intn(2) + 1), Call: tick()}
+					releaser, err := sem.Try(nil, op.Places)
+					op.Return, op.Ok = tick(), err == nil
+					if err != nil && !semaphore.IsNoPlace(err) {
+						commit(op, err)
+						continue
+					}
+					commit(op, nil)
+					if op.Ok {
+						release(releaser, op.Places, tick, commit)
+					}
+				case 2:
+					op := Operation{Kind: OpPeek, Call: tick()}
+					op.Places = sem.Peek()
+					op.Return = tick()
+					commit(op, nil)
+				}
+			}
+		}(rand.New(rand.NewSource(seed*goroutines + int64(g))))
+	}
+	wg.Wait()
+	return history, failure
+}
+
+func release(releaser semaphore.Releaser, places uint32, tick func() uint64, commit func(Operation, error)) {
+	op := Operation{Kind: OpRelease, Places: places, Ok: true, Call: tick()}
+	err := releaser.Release()
+	op.Return = tick()
+	commit(op, err)
+}
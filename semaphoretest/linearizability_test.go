@@ -0,0 +1,51 @@
+package semaphoretest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinearizable(t *testing.T) {
+	tests := []struct {
+		name     string
+		history  []Operation
+		expected bool
+	}{
+		{"empty", nil, true},
+		{"sequential", []Operation{
+			{Kind: OpTry, Places: 2, Ok: true, Call: 1, Return: 2},
+			{Kind: OpTry, Places: 1, Ok: false, Call: 3, Return: 4},
+			{Kind: OpRelease, Places: 2, Ok: true, Call: 5, Return: 6},
+			{Kind: OpPeek, Places: 0, Call: 7, Return: 8},
+		}, true},
+		{"overlapped", []Operation{
+			{Kind: OpTry, Places: 2, Ok: true, Call: 1, Return: 6},
+			{Kind: OpPeek, Places: 0, Call: 2, Return: 3},
+			{Kind: OpTry, Places: 1, Ok: false, Call: 4, Return: 5},
+		}, true},
+		{"reordered", []Operation{
+			{Kind: OpTry, Places: 2, Ok: true, Call: 1, Return: 6},
+			{Kind: OpPeek, Places: 2, Call: 2, Return: 3},
+			{Kind: OpPeek, Places: 0, Call: 4, Return: 5},
+		}, false},
+		{"blocked", []Operation{
+			{Kind: OpTry, Places: 2, Ok: true, Call: 1, Return: 2},
+			{Kind: OpAcquire, Places: 1, Ok: true, Call: 3, Return: 6},
+			{Kind: OpRelease, Places: 2, Ok: true, Call: 4, Return: 5},
+		}, true},
+		{"stale peek", []Operation{
+			{Kind: OpTry, Places: 1, Ok: true, Call: 1, Return: 2},
+			{Kind: OpPeek, Places: 0, Call: 3, Return: 4},
+		}, false},
+		{"overflow", []Operation{
+			{Kind: OpAcquire, Places: 2, Ok: true, Call: 1, Return: 2},
+			{Kind: OpAcquire, Places: 2, Ok: true, Call: 3, Return: 4},
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Linearizable(2, test.history))
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package semaphoretest
+
+import (
+	"runtime"
+
+	"github.com/kamilsk/semaphore/v5"
+)
+
+// WaitForWaiters blocks until the given number of goroutines
+// wait in the queue of the semaphore.
+func WaitForWaiters(semaphore interface{ Stats() semaphore.Stats }, waiters uint32) {
+	for semaphore.Stats().Waiting != waiters {
+		runtime.Gosched()
+	}
+}
+
+// WaitForOccupied blocks until the given number of places
+// is occupied in the semaphore.
+func WaitForOccupied(semaphore interface{ Peek() uint32 }, places uint32) {
+	for semaphore.Peek() != places {
+		runtime.Gosched()
+	}
+}
+
+// WaitForLegacyWaiters blocks until the given number of goroutines
+// wait for a slot of the semaphore.
+func WaitForLegacyWaiters(semaphore semaphore.HealthChecker, waiters int) {
+	for semaphore.Waiting() != waiters {
+		runtime.Gosched()
+	}
+}
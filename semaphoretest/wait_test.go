@@ -0,0 +1,64 @@
+package semaphoretest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kamilsk/semaphore/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForWaiters(t *testing.T) {
+	sem := semaphore.NewWeighted(1)
+	releaser, err := sem.Acquire(nil, 1)
+	assert.NoError(t, err)
+
+	breaker := NewBreaker()
+	done := make(chan error)
+	go func() {
+		_, err := sem.Acquire(breaker, 1)
+		done <- err
+	}()
+	WaitForWaiters(sem, 1)
+
+	breaker.Break()
+	assert.True(t, semaphore.IsTimeout(<-done))
+	assert.NoError(t, releaser.Release())
+}
+
+func TestWaitForLegacyWaiters(t *testing.T) {
+	sem := semaphore.New(1)
+	release, err := sem.Acquire(nil)
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		release, _ := sem.Acquire(nil)
+		release()
+		close(done)
+	}()
+	WaitForLegacyWaiters(sem, 1)
+
+	release()
+	<-done
+	assert.Equal(t, 0, sem.Occupied())
+}
+
+func TestClock_Semaphore(t *testing.T) {
+	clock := NewClock(time.Unix(0, 0))
+	sem := semaphore.NewWeighted(1, semaphore.WithClock(clock))
+	releaser, err := sem.Acquire(nil, 1)
+	assert.NoError(t, err)
+
+	breaker := clock.BreakAfter(time.Second)
+	done := make(chan error)
+	go func() {
+		_, err := sem.Acquire(breaker, 1)
+		done <- err
+	}()
+	WaitForWaiters(sem, 1)
+
+	clock.Advance(time.Second)
+	assert.True(t, semaphore.IsTimeout(<-done))
+	assert.NoError(t, releaser.Release())
+}
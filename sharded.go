@@ -0,0 +1,230 @@
+package semaphore
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// NewSharded constructs a new thread-safe semaphore with the given capacity
+// split across the given number of shards. If shards is not positive,
+// the number of shards is equal to GOMAXPROCS.
+//
+// Every goroutine occupies places in the shard assigned to its processor
+// and steals them from other shards when that one runs dry, so there is
+// no single counter contended by all processors. The capacity is exact:
+// places are occupied only if the shards have enough of them in total.
+// Unlike NewWeighted, waiters are not served in the order of their arrival.
+func NewSharded(capacity uint32, shards int) Sharded {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	semaphore := &sharded{capacity: capacity, shards: make([]shard, shards), wake: make(chan struct{})}
+	for i := range semaphore.shards {
+		semaphore.shards[i].free = capacity / uint32(shards)
+		if uint32(i) < capacity%uint32(shards) {
+			semaphore.shards[i].free++
+		}
+	}
+	semaphore.hints.New = func() interface{} {
+		return &hint{index: int(atomic.AddUint32(&semaphore.next, 1)-1) % shards}
+	}
+	return semaphore
+}
+
+// Sharded defines the functionality of the Semaphore pattern
+// with the capacity split across shards.
+type Sharded interface {
+	// Acquire occupies the places. The operation can be canceled using breaker.
+	// In this case, it returns an appropriate error.
+	Acquire(BreakCloser, ...uint32) (Releaser, error)
+	// Try tries to occupy the places without waiting.
+	Try(Breaker, ...uint32) (Releaser, error)
+
+	// Peek returns the number of occupied places in all shards.
+	Peek() uint32
+	// Stats returns the capacity, the occupied places and the number of waiters.
+	Stats() Stats
+}
+
+type sharded struct {
+	capacity uint32
+	next     uint32
+	waiting  int32
+	shards   []shard
+	hints    sync.Pool
+
+	mu   sync.Mutex
+	wake chan struct{}
+}
+
+// shard holds free places. It is padded to occupy its own cache line.
+// Its mutex is held by the steal that takes its places until it ends.
+type shard struct {
+	free uint32
+	mu   sync.Mutex
+	_    [52]byte
+}
+
+// hint is the shard preferred by the processor that got it from the pool.
+type hint struct {
+	index int
+}
+
+// portion is the number of places occupied in the shard.
+type portion struct {
+	index  int
+	places uint32
+}
+
+func (semaphore *sharded) Acquire(breaker BreakCloser, places ...uint32) (Releaser, error) {
+	size := reduce(places...)
+	if releaser := semaphore.take(size); releaser != nil {
+		return releaser, nil
+	}
+
+	atomic.AddInt32(&semaphore.waiting, 1)
+	defer atomic.AddInt32(&semaphore.waiting, -1)
+	for {
+		semaphore.mu.Lock()
+		wake := semaphore.wake
+		semaphore.mu.Unlock()
+		if releaser := semaphore.take(size); releaser != nil {
+			return releaser, nil
+		}
+		select {
+		case <-wake:
+		case <-done(breaker):
+			return nil, errTimeout
+		}
+	}
+}
+
+func (semaphore *sharded) Try(breaker Breaker, places ...uint32) (Releaser, error) {
+	select {
+	case <-done(breaker):
+		return nil, errTimeout
+	default:
+	}
+	if releaser := semaphore.take(reduce(places...)); releaser != nil {
+		return releaser, nil
+	}
+	return nil, errNoPlace
+}
+
+func (semaphore *sharded) Peek() uint32 {
+	var free uint32
+	for i := range semaphore.shards {
+		free += atomic.LoadUint32(&semaphore.shards[i].free)
+	}
+	return semaphore.capacity - free
+}
+
+func (semaphore *sharded) Stats() Stats {
+	return Stats{
+		Capacity: semaphore.capacity,
+		Occupied: semaphore.Peek(),
+		Waiting:  uint32(atomic.LoadInt32(&semaphore.waiting)),
+	}
+}
+
+// take occupies the places in the preferred shard or steals them
+// from the others. It returns nil if the shards have not enough places.
+func (semaphore *sharded) take(size uint32) *shardedReleaser {
+	h := semaphore.hints.Get().(*hint)
+	defer semaphore.hints.Put(h)
+
+	if semaphore.shards[h.index].take(size, size) == size {
+		releaser := &shardedReleaser{semaphore: semaphore, own: [1]portion{{index: h.index, places: size}}}
+		releaser.takes = releaser.own[:1]
+		return releaser
+	}
+
+	// the shards are locked in the order of their indexes, and the ones
+	// the places are taken from stay locked until the steal ends, so
+	// a failed steal holds no places that another steal could miss,
+	// and it is rolled back silently: nobody could wait for them
+	var takes []portion
+	need := size
+	for index := range semaphore.shards {
+		if need == 0 {
+			break
+		}
+		shard := &semaphore.shards[index]
+		shard.mu.Lock()
+		if places := shard.take(1, need); places > 0 {
+			takes = append(takes, portion{index: index, places: places})
+			need -= places
+			continue
+		}
+		shard.mu.Unlock()
+	}
+	if need > 0 {
+		semaphore.restore(takes)
+	}
+	for _, portion := range takes {
+		semaphore.shards[portion.index].mu.Unlock()
+	}
+	if need > 0 {
+		return nil
+	}
+	if len(takes) == 1 {
+		// the shard of the processor runs dry, so prefer the one with places
+		h.index = takes[0].index
+	}
+	return &shardedReleaser{semaphore: semaphore, takes: takes}
+}
+
+// give returns the places to the shards and wakes the waiters.
+func (semaphore *sharded) give(takes []portion) {
+	if len(takes) == 0 {
+		return
+	}
+	semaphore.restore(takes)
+	if atomic.LoadInt32(&semaphore.waiting) > 0 {
+		semaphore.mu.Lock()
+		close(semaphore.wake)
+		semaphore.wake = make(chan struct{})
+		semaphore.mu.Unlock()
+	}
+}
+
+// restore returns the places to the shards without waking the waiters.
+func (semaphore *sharded) restore(takes []portion) {
+	for _, portion := range takes {
+		atomic.AddUint32(&semaphore.shards[portion.index].free, portion.places)
+	}
+}
+
+// take occupies at least min and at most max places of the shard.
+// It returns zero if the shard has less than min places.
+func (shard *shard) take(min, max uint32) uint32 {
+	for {
+		free := atomic.LoadUint32(&shard.free)
+		if free < min {
+			return 0
+		}
+		places := max
+		if free < places {
+			places = free
+		}
+		if atomic.CompareAndSwapUint32(&shard.free, free, free-places) {
+			return places
+		}
+	}
+}
+
+type shardedReleaser struct {
+	semaphore *sharded
+	own       [1]portion
+	takes     []portion
+	released  uint32
+}
+
+func (releaser *shardedReleaser) Release() error {
+	if !atomic.CompareAndSwapUint32(&releaser.released, 0, 1) {
+		return errEmpty
+	}
+	releaser.semaphore.give(releaser.takes)
+	return nil
+}
@@ -0,0 +1,224 @@
+package semaphore
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharded_Capacity(t *testing.T) {
+	for _, shards := range []int{1, 3, 8, 16} {
+		t.Run(fmt.Sprintf("shards=%d", shards), func(t *testing.T) {
+			semaphore := NewSharded(10, shards)
+			releasers := make([]Releaser, 0, 10)
+			for i := 0; i < 10; i++ {
+				releaser, err := semaphore.Try(nil)
+				assert.NoError(t, err)
+				releasers = append(releasers, releaser)
+			}
+			assert.Equal(t, uint32(10), semaphore.Peek())
+			_, err := semaphore.Try(nil)
+			assert.True(t, IsNoPlace(err))
+
+			for _, releaser := range releasers {
+				assert.NoError(t, releaser.Release())
+			}
+			assert.Equal(t, uint32(0), semaphore.Peek())
+			assert.True(t, IsEmpty(releasers[0].Release()))
+		})
+	}
+}
+
+func TestSharded_Steal(t *testing.T) {
+	semaphore := NewSharded(8, 4)
+	releaser, err := semaphore.Try(nil, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(8), semaphore.Peek())
+	_, err = semaphore.Try(nil)
+	assert.True(t, IsNoPlace(err))
+	assert.NoError(t, releaser.Release())
+
+	first, _ := semaphore.Try(nil, 3)
+	second, _ := semaphore.Try(nil, 3)
+	_, err = semaphore.Try(nil, 3)
+	assert.True(t, IsNoPlace(err))
+	assert.Equal(t, uint32(6), semaphore.Peek())
+	third, err := semaphore.Try(nil, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Capacity: 8, Occupied: 8}, semaphore.Stats())
+
+	for _, releaser := range []Releaser{first, second, third} {
+		assert.NoError(t, releaser.Release())
+	}
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestSharded_Acquire(t *testing.T) {
+	semaphore := NewSharded(4, 2)
+	releaser, err := semaphore.Acquire(nil, 4)
+	assert.NoError(t, err)
+
+	done := make(chan Releaser)
+	go func() {
+		releaser, _ := semaphore.Acquire(nil, 3)
+		done <- releaser
+	}()
+	waitFor(semaphore, 1)
+	assert.NoError(t, releaser.Release())
+	assert.NoError(t, (<-done).Release())
+
+	releaser, _ = semaphore.Try(nil, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := semaphore.Acquire(breaker{ctx}, 1)
+		errs <- err
+	}()
+	waitFor(semaphore, 1)
+	cancel()
+	assert.True(t, IsTimeout(<-errs))
+	assert.Equal(t, Stats{Capacity: 4, Occupied: 4}, semaphore.Stats())
+	assert.NoError(t, releaser.Release())
+
+	_, err = semaphore.Try(breaker{ctx})
+	assert.True(t, IsTimeout(err))
+}
+
+func TestSharded_Parked(t *testing.T) {
+	semaphore := NewSharded(4, 4)
+	releaser, err := semaphore.Try(nil, 3)
+	assert.NoError(t, err)
+
+	done := make(chan Releaser)
+	go func() {
+		releaser, _ := semaphore.Acquire(nil, 2)
+		done <- releaser
+	}()
+	waitFor(semaphore, 1)
+	impl := semaphore.(*sharded)
+	impl.mu.Lock()
+	wake := impl.wake
+	impl.mu.Unlock()
+	for i := 0; i < 100; i++ {
+		runtime.Gosched()
+	}
+	impl.mu.Lock()
+	assert.True(t, wake == impl.wake, "the parked waiter must not wake itself")
+	impl.mu.Unlock()
+	assert.Equal(t, uint32(3), semaphore.Peek(), "the parked waiter must not hold places")
+
+	free, err := semaphore.Try(nil)
+	assert.NoError(t, err, "the free place must not be held by the parked waiter")
+	assert.NoError(t, free.Release())
+	assert.NoError(t, releaser.Release())
+	assert.NoError(t, (<-done).Release())
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestSharded_Steals(t *testing.T) {
+	semaphore := NewSharded(4, 4)
+	for round := 0; round < 1000; round++ {
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				releaser, err := semaphore.Try(nil, 2)
+				if assert.NoError(t, err, "the concurrent steals must not fail while the places are free") {
+					defer func() { assert.NoError(t, releaser.Release()) }()
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+		if t.Failed() {
+			return
+		}
+	}
+}
+
+func TestSharded_Concurrently(t *testing.T) {
+	const capacity = 5
+
+	semaphore := NewSharded(capacity, 3)
+	var (
+		active, max int32
+		wg          sync.WaitGroup
+	)
+	for i := 0; i < 4*runtime.GOMAXPROCS(0)+4; i++ {
+		wg.Add(1)
+		go func(places uint32) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				releaser, err := semaphore.Acquire(nil, places)
+				if !assert.NoError(t, err) {
+					return
+				}
+				current := atomic.AddInt32(&active, int32(places))
+				for {
+					seen := atomic.LoadInt32(&max)
+					if current <= seen || atomic.CompareAndSwapInt32(&max, seen, current) {
+						break
+					}
+				}
+				runtime.Gosched()
+				atomic.AddInt32(&active, -int32(places))
+				assert.NoError(t, releaser.Release())
+			}
+		}(uint32(i%3 + 1))
+	}
+	wg.Wait()
+	assert.True(t, max <= capacity)
+	assert.Equal(t, Stats{Capacity: capacity}, semaphore.Stats())
+}
+
+type weightedAcquirer interface {
+	Acquire(breaker BreakCloser, places ...uint32) (Releaser, error)
+}
+
+func BenchmarkSharded(b *testing.B) {
+	implementations := []struct {
+		name string
+		new  func(capacity uint32) weightedAcquirer
+	}{
+		{"weighted", func(capacity uint32) weightedAcquirer { return NewWeighted(capacity) }},
+		{"sharded", func(capacity uint32) weightedAcquirer { return NewSharded(capacity, 0) }},
+	}
+	for _, procs := range []int{1, 2, 4, 8, 16, 32, 64} {
+		for _, implementation := range implementations {
+			b.Run(fmt.Sprintf("procs=%d/%s", procs, implementation.name), func(b *testing.B) {
+				defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+				semaphore := implementation.new(1024)
+				b.ReportAllocs()
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						releaser, _ := semaphore.Acquire(nil)
+						_ = releaser.Release()
+					}
+				})
+			})
+		}
+	}
+	for _, procs := range []int{1, 8, 64} {
+		b.Run(fmt.Sprintf("procs=%d/legacy", procs), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+			semaphore := New(1024)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					release, _ := semaphore.Acquire(nil)
+					release()
+				}
+			})
+		})
+	}
+}
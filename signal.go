@@ -0,0 +1,98 @@
+package semaphore
+
+import "container/list"
+
+// signal delivers the result to the waiter that has no goroutine
+// waiting for it. The result is reclaimed if it is still undelivered
+// when the breaker fires.
+type signal struct {
+	source      Breaker
+	waiter      *waiter
+	elem        *list.Element
+	lease       *list.Element
+	deliver     func(*releaser)
+	undelivered func() bool
+	reclaim     func() *releaser
+}
+
+func (semaphore *draft) Signal(breaker Breaker) <-chan Releaser {
+	ch := make(chan Releaser, 1)
+	semaphore.signal(breaker, &signal{
+		deliver: func(releaser *releaser) {
+			if releaser != nil {
+				ch <- releaser
+			}
+			close(ch)
+		},
+		undelivered: func() bool { return len(ch) > 0 },
+		reclaim: func() *releaser {
+			select {
+			case result, ok := <-ch:
+				if ok {
+					return result.(*releaser)
+				}
+			default:
+			}
+			return nil
+		},
+	})
+	return ch
+}
+
+// signal puts the goroutine-free waiter in the queue.
+func (semaphore *draft) signal(breaker Breaker, sig *signal) {
+	if fired(breaker) {
+		sig.deliver(nil)
+		return
+	}
+
+	w := &waiter{places: 1, upto: 1, since: semaphore.now(), ready: make(chan struct{}), signal: sig}
+	sig.source, sig.waiter = breaker, w
+	semaphore.lock()
+	defer semaphore.unlock()
+	elem, err := semaphore.enter(breaker, w)
+	if err != nil {
+		sig.deliver(nil)
+		return
+	}
+	if elem == nil {
+		close(w.ready)
+		sig.deliver(w.releaser)
+	}
+	if done(breaker) != nil {
+		sig.elem, sig.lease = elem, semaphore.lease(sig)
+		if w.releaser != nil {
+			w.releaser.lease = sig.lease
+		}
+	}
+}
+
+func (sig *signal) breaker() Breaker {
+	return sig.source
+}
+
+// reap rejects the waiting signal or reclaims the undelivered result
+// if the breaker has fired. It must be called under the lock.
+func (sig *signal) reap(semaphore *draft) bool {
+	select {
+	case <-sig.waiter.ready:
+		if !sig.undelivered() {
+			return true
+		}
+		if !fired(sig.source) {
+			return false
+		}
+		if releaser := sig.reclaim(); releaser != nil {
+			semaphore.expire(releaser)
+		}
+		return true
+	default:
+		if !fired(sig.source) {
+			return false
+		}
+		semaphore.dequeue(sig.elem)
+		sig.waiter.err = errTimeout
+		sig.waiter.wake(semaphore)
+		return true
+	}
+}
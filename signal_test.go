@@ -0,0 +1,147 @@
+package semaphore
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDraft_Signal(t *testing.T) {
+	semaphore := NewWeighted(1)
+
+	releaser, ok := <-semaphore.Signal(nil)
+	assert.True(t, ok)
+	goroutines := runtime.NumGoroutine()
+	signal := semaphore.Signal(nil)
+	assert.Equal(t, goroutines, runtime.NumGoroutine(), "a goroutine must not be spawned")
+	assert.Equal(t, uint32(1), semaphore.Stats().Waiting)
+
+	assert.NoError(t, releaser.Release())
+	releaser, ok = <-signal
+	assert.True(t, ok)
+	assert.NoError(t, releaser.Release())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, ok = <-semaphore.Signal(ctx)
+	assert.False(t, ok)
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestDraft_Signal_Goroutines(t *testing.T) {
+	semaphore := NewWeighted(1)
+	goroutines := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	releaser, ok := <-semaphore.Signal(ctx)
+	assert.True(t, ok)
+	assert.NoError(t, releaser.Release())
+	for runtime.NumGoroutine() > goroutines {
+		runtime.Gosched()
+	}
+	cancel()
+
+	releaser, _ = semaphore.Acquire(nil)
+	ctx, cancel = context.WithCancel(context.Background())
+	signal := semaphore.Signal(ctx)
+	cancel()
+	_, ok = <-signal
+	assert.False(t, ok)
+	for runtime.NumGoroutine() > goroutines {
+		runtime.Gosched()
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	_ = semaphore.Signal(ctx)
+	assert.NoError(t, releaser.Release())
+	cancel()
+	for runtime.NumGoroutine() > goroutines || semaphore.Peek() != 0 {
+		runtime.Gosched()
+	}
+}
+
+func TestDraft_Signal_Abandoned(t *testing.T) {
+	semaphore := NewWeighted(1)
+	releaser, _ := semaphore.Acquire(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_ = semaphore.Signal(ctx)
+	waitFor(semaphore, 1)
+
+	done := make(chan Releaser)
+	go func() {
+		releaser, _ := semaphore.Acquire(nil)
+		done <- releaser
+	}()
+	waitFor(semaphore, 2)
+
+	assert.NoError(t, releaser.Release())
+	assert.Equal(t, uint32(1), semaphore.Peek(), "the place must be held by the signal")
+	cancel()
+	assert.NoError(t, (<-done).Release(), "the place must be reclaimed from the signal")
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestDraft_Signal_Canceled(t *testing.T) {
+	semaphore := NewWeighted(1)
+	releaser, _ := semaphore.Acquire(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signal := semaphore.Signal(ctx)
+	cancel()
+
+	_, err := semaphore.Try(nil)
+	assert.True(t, IsNoPlace(err))
+	_, ok := <-signal
+	assert.False(t, ok)
+	assert.Equal(t, uint32(0), semaphore.Stats().Waiting)
+	assert.NoError(t, releaser.Release())
+}
+
+func TestSemaphore_Signal_Abandoned(t *testing.T) {
+	semaphore := New(1)
+	release, _ := semaphore.Acquire(nil)
+
+	deadline := make(chan struct{})
+	_ = semaphore.Signal(deadline)
+	assert.Equal(t, 1, semaphore.Waiting())
+
+	release()
+	assert.Equal(t, 1, semaphore.Occupied())
+	close(deadline)
+	for semaphore.Occupied() != 0 {
+		runtime.Gosched()
+	}
+	release, err := semaphore.Catch()
+	assert.NoError(t, err)
+	release()
+	assert.Equal(t, 0, semaphore.Occupied())
+}
+
+func TestDraft_Signal_AbandonedBehind(t *testing.T) {
+	semaphore := NewWeighted(2)
+	first, _ := semaphore.Acquire(nil)
+	second, _ := semaphore.Acquire(nil)
+
+	front := semaphore.Signal(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	_ = semaphore.Signal(ctx)
+	waitFor(semaphore, 2)
+
+	done := make(chan Releaser)
+	go func() {
+		releaser, _ := semaphore.Acquire(nil)
+		done <- releaser
+	}()
+	waitFor(semaphore, 3)
+
+	assert.NoError(t, first.Release())
+	assert.NoError(t, second.Release())
+	assert.Equal(t, uint32(2), semaphore.Peek(), "the places must be held by the signals")
+	cancel()
+	assert.NoError(t, (<-done).Release(), "the place must be reclaimed from the second signal")
+	assert.NoError(t, (<-front).Release())
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
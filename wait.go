@@ -0,0 +1,116 @@
+package semaphore
+
+import "container/list"
+
+// observer waits for free places without occupying them.
+type observer struct {
+	source Breaker
+	elem   *list.Element
+	lease  *list.Element
+	places uint32
+	ready  chan struct{}
+	err    error
+}
+
+func (o *observer) breaker() Breaker {
+	return o.source
+}
+
+// reap forgets the observer if the breaker has fired.
+// It must be called under the lock.
+func (o *observer) reap(semaphore *draft) bool {
+	if o.elem == nil {
+		return true
+	}
+	if !fired(o.source) {
+		return false
+	}
+	o.forget(semaphore)
+	return true
+}
+
+// forget removes the observer from the semaphore.
+// It must be called under the lock.
+func (o *observer) forget(semaphore *draft) {
+	semaphore.watch.Remove(o.elem)
+	semaphore.unlease(o.lease)
+	o.elem = nil
+}
+
+func (semaphore *draft) Wait(breaker Breaker, places ...uint32) error {
+	semaphore.lock()
+	if semaphore.closed {
+		semaphore.unlock()
+		return errClosed
+	}
+	o := semaphore.register(breaker, reduce(places...))
+	semaphore.unlock()
+	if o == nil {
+		return nil
+	}
+
+	select {
+	case <-o.ready:
+		return o.err
+	case <-done(breaker):
+		semaphore.lock()
+		defer semaphore.unlock()
+		select {
+		case <-o.ready:
+			return o.err
+		default:
+			o.forget(semaphore)
+			return errTimeout
+		}
+	}
+}
+
+func (semaphore *draft) Available(breaker Breaker, places ...uint32) <-chan struct{} {
+	semaphore.lock()
+	defer semaphore.unlock()
+	if semaphore.closed {
+		return closedchan
+	}
+	if fired(breaker) {
+		return make(chan struct{})
+	}
+	o := semaphore.register(breaker, reduce(places...))
+	if o == nil {
+		return closedchan
+	}
+	if done(breaker) != nil {
+		// nobody waits for the channel to forget it on the cancellation
+		o.lease = semaphore.lease(o)
+	}
+	return o.ready
+}
+
+// register adds the observer of free places or returns nil
+// if they are already free. It must be called under the lock.
+func (semaphore *draft) register(breaker Breaker, size uint32) *observer {
+	if semaphore.fits(size) {
+		return nil
+	}
+	o := &observer{source: breaker, places: size, ready: make(chan struct{})}
+	o.elem = semaphore.watch.PushBack(o)
+	return o
+}
+
+// observe notifies the observers of free places.
+// It must be called under the lock.
+func (semaphore *draft) observe() {
+	for elem := semaphore.watch.Front(); elem != nil; {
+		next := elem.Next()
+		if o := elem.Value.(*observer); semaphore.fits(o.places) {
+			o.forget(semaphore)
+			close(o.ready)
+		}
+		elem = next
+	}
+}
+
+var closedchan = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
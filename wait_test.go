@@ -0,0 +1,66 @@
+package semaphore
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDraft_Wait(t *testing.T) {
+	semaphore := NewWeighted(4)
+	releaser, _ := semaphore.Acquire(nil, 3)
+
+	assert.NoError(t, semaphore.Wait(nil, 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.True(t, IsTimeout(semaphore.Wait(ctx, 2)))
+
+	done := make(chan error)
+	go func() { done <- semaphore.Wait(nil, 4) }()
+	available := semaphore.Available(nil, 2)
+	select {
+	case <-available:
+		t.Fatal("unexpected availability")
+	default:
+	}
+
+	assert.NoError(t, releaser.(Holder).Shrink(2))
+	<-available
+	assert.Equal(t, uint32(1), semaphore.Peek(), "places must not be occupied")
+	assert.NoError(t, releaser.Release())
+	assert.NoError(t, <-done)
+	assert.Equal(t, uint32(0), semaphore.Peek())
+}
+
+func TestDraft_Available(t *testing.T) {
+	semaphore := NewWeighted(2)
+	releaser, _ := semaphore.Acquire(nil, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_ = semaphore.Available(ctx, 1)
+	assert.Equal(t, 1, observers(semaphore))
+	cancel()
+	for observers(semaphore) != 0 {
+		runtime.Gosched()
+	}
+
+	done := make(chan error)
+	go func() { done <- semaphore.Wait(nil, 1) }()
+	available := semaphore.Available(nil, 2)
+	for observers(semaphore) != 2 {
+		runtime.Gosched()
+	}
+	assert.NoError(t, semaphore.Close())
+	<-available
+	assert.True(t, IsClosed(<-done))
+	assert.Equal(t, 0, observers(semaphore))
+	assert.NoError(t, releaser.Release())
+}
+
+func observers(semaphore Interface) int {
+	semaphore.(*draft).lock()
+	defer semaphore.(*draft).unlock()
+	return semaphore.(*draft).watch.Len()
+}